@@ -0,0 +1,141 @@
+package gorefactor
+
+import (
+	"github.com/dave/dst"
+)
+
+// Occurrence decides which of the statements matched by an anchor are used
+type Occurrence int
+
+const (
+	// AllOccurrences uses every matched statement
+	AllOccurrences Occurrence = iota
+	// FirstOccurrence uses the first matched statement, in source order
+	FirstOccurrence
+	// LastOccurrence uses the last matched statement, in source order
+	LastOccurrence
+)
+
+// Anchor matches the statements, in a function body, that other statements are inserted relative to.
+// Statements inside function literals are skipped unless InFuncLits is set, as they run in another
+// function. Only statements in statement lists, e.g. blocks and case clauses, can be matched.
+type Anchor struct {
+	Match      func(stmt dst.Stmt) bool
+	Occurrence Occurrence
+	InFuncLits bool
+}
+
+// StmtAnchor matches statements semantically equal to the given one, including the ones in function literals
+func StmtAnchor(stmt dst.Stmt, occurrence Occurrence) Anchor {
+	return Anchor{
+		Match: func(ss dst.Stmt) bool {
+			return nodesEqual(ss, stmt)
+		},
+		Occurrence: occurrence,
+		InFuncLits: true,
+	}
+}
+
+// AssignAnchor matches statements assigning to, or declaring, the variable of the given name,
+// e.g. `err = f()`, `v, err := f()` and `var err error`
+func AssignAnchor(varName string, occurrence Occurrence) Anchor {
+	return Anchor{
+		Match: func(stmt dst.Stmt) bool {
+			switch ss := stmt.(type) {
+			case *dst.AssignStmt:
+				for _, lhs := range ss.Lhs {
+					if isIdentNamed(lhs, varName) {
+						return true
+					}
+				}
+			case *dst.DeclStmt:
+				if gd, ok := ss.Decl.(*dst.GenDecl); ok {
+					for _, spec := range gd.Specs {
+						if vs, ok := spec.(*dst.ValueSpec); ok && specDeclares(vs, varName) {
+							return true
+						}
+					}
+				}
+			}
+			return false
+		},
+		Occurrence: occurrence,
+	}
+}
+
+// ReturnAnchor matches return statements
+func ReturnAnchor(occurrence Occurrence) Anchor {
+	return Anchor{
+		Match: func(stmt dst.Stmt) bool {
+			_, ok := stmt.(*dst.ReturnStmt)
+			return ok
+		},
+		Occurrence: occurrence,
+	}
+}
+
+// UsesIdentAnchor matches statements referring to the local identifier of the given name. A statement
+// containing others, like an if statement, is matched as a whole rather than the ones inside.
+func UsesIdentAnchor(name string, occurrence Occurrence) Anchor {
+	return Anchor{
+		Match: func(stmt dst.Stmt) (ret bool) {
+			dst.Inspect(stmt, func(n dst.Node) bool {
+				if ident, ok := n.(*dst.Ident); ok && ident.Path == "" && ident.Name == name {
+					ret = true
+				}
+				return !ret
+			})
+			return
+		},
+		Occurrence: occurrence,
+	}
+}
+
+// find finds the statements matched by the anchor in the function body, in source order
+func (a Anchor) find(body *dst.BlockStmt) []dst.Stmt {
+	var matched []dst.Stmt
+	var visitList func(list []dst.Stmt)
+	var visit func(node dst.Node)
+
+	visitList = func(list []dst.Stmt) {
+		for _, stmt := range list {
+			if a.Match(stmt) {
+				matched = append(matched, stmt)
+				continue
+			}
+			visit(stmt)
+		}
+	}
+	visit = func(node dst.Node) {
+		dst.Inspect(node, func(n dst.Node) bool {
+			switch nn := n.(type) {
+			case *dst.FuncLit:
+				if !a.InFuncLits {
+					return false
+				}
+			case *dst.BlockStmt:
+				visitList(nn.List)
+				return false
+			case *dst.CaseClause:
+				visitList(nn.Body)
+				return false
+			case *dst.CommClause:
+				visitList(nn.Body)
+				return false
+			}
+			return true
+		})
+	}
+	visitList(body.List)
+
+	if len(matched) == 0 {
+		return nil
+	}
+	switch a.Occurrence {
+	case FirstOccurrence:
+		return matched[:1]
+	case LastOccurrence:
+		return matched[len(matched)-1:]
+	}
+	return matched
+}
@@ -0,0 +1,192 @@
+package gorefactor
+
+import (
+	"github.com/dave/dst"
+	"go/types"
+)
+
+// CallGraph is a static call graph of the functions and methods declared in a set of loaded packages.
+// Calls of interface methods are resolved by class hierarchy analysis, i.e. to the method of every
+// type, in the packages, implementing the interface. Calls of function values are not resolved.
+// Functions are named as types.Func.FullName, e.g. "database/sql.Open" or "(*database/sql.DB).Query".
+type CallGraph struct {
+	funcs   map[string]*types.Func
+	callers map[*types.Func][]*types.Func
+	decls   map[*types.Func]Caller
+	order   []*types.Func
+}
+
+// Caller is a function declared in a loaded package calling another one. Scope can be used to apply
+// other utilities in the body of the function, like AddArgToCallExpr(caller.File, caller.Scope, ...),
+// it's limited to the very declaration, so methods of other types sharing the name are left untouched.
+type Caller struct {
+	Func    *types.Func
+	Package *Package
+	File    *dst.File
+	Scope   Scope
+}
+
+// BuildCallGraph builds the call graph of the functions declared in pkgs, calls inside function
+// literals are attributed to the function declaring them
+func BuildCallGraph(pkgs []*Package) *CallGraph {
+	g := &CallGraph{
+		funcs:   make(map[string]*types.Func),
+		callers: make(map[*types.Func][]*types.Func),
+		decls:   make(map[*types.Func]Caller),
+	}
+	implementations := make(map[*types.Func][]*types.Func)
+
+	for _, pkg := range pkgs {
+		for _, df := range pkg.Files {
+			for _, decl := range df.Decls {
+				fd, ok := decl.(*dst.FuncDecl)
+				if !ok || fd.Body == nil {
+					continue
+				}
+				caller, ok := pkg.ObjectOf(fd.Name).(*types.Func)
+				if !ok {
+					continue
+				}
+				g.addFunc(caller)
+				g.decls[caller] = Caller{Func: caller, Package: pkg, File: df, Scope: Scope{FuncName: fd.Name.Name, FuncDecl: fd}}
+				g.order = append(g.order, caller)
+
+				seen := make(map[*types.Func]bool)
+				dst.Inspect(fd.Body, func(n dst.Node) bool {
+					ce, ok := n.(*dst.CallExpr)
+					if !ok {
+						return true
+					}
+					callee := calledFunc(pkg, ce)
+					if callee == nil {
+						return true
+					}
+					// methods of instantiated generic types, like S[int].Add, are recorded as declared
+					callee = callee.Origin()
+
+					callees := []*types.Func{callee}
+					if isInterfaceMethod(callee) {
+						if _, ok := implementations[callee]; !ok {
+							implementations[callee] = findImplementations(pkgs, callee)
+						}
+						callees = append(callees, implementations[callee]...)
+					}
+					for _, callee := range callees {
+						if !seen[callee] {
+							seen[callee] = true
+							g.addFunc(callee)
+							g.callers[callee] = append(g.callers[callee], caller)
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+	return g
+}
+
+func (g *CallGraph) addFunc(fn *types.Func) {
+	g.funcs[fn.FullName()] = fn
+}
+
+// Callers returns the functions, declared in the loaded packages, calling the function directly
+func (g *CallGraph) Callers(funcName string) []Caller {
+	fn, ok := g.funcs[funcName]
+	if !ok {
+		return nil
+	}
+
+	found := make(map[*types.Func]bool)
+	for _, caller := range g.callers[fn] {
+		found[caller] = true
+	}
+	return g.sorted(found)
+}
+
+// TransitiveCallers returns the functions, declared in the loaded packages, calling the function
+// directly or through other functions
+func (g *CallGraph) TransitiveCallers(funcName string) []Caller {
+	fn, ok := g.funcs[funcName]
+	if !ok {
+		return nil
+	}
+
+	found := make(map[*types.Func]bool)
+	queue := []*types.Func{fn}
+	for len(queue) > 0 {
+		callee := queue[0]
+		queue = queue[1:]
+		for _, caller := range g.callers[callee] {
+			if !found[caller] {
+				found[caller] = true
+				queue = append(queue, caller)
+			}
+		}
+	}
+	return g.sorted(found)
+}
+
+// sorted returns the callers in the order they are declared
+func (g *CallGraph) sorted(found map[*types.Func]bool) (callers []Caller) {
+	for _, fn := range g.order {
+		if found[fn] {
+			callers = append(callers, g.decls[fn])
+		}
+	}
+	return
+}
+
+// calledFunc returns the function or method called statically, or the interface method called
+func calledFunc(pkg *Package, ce *dst.CallExpr) *types.Func {
+	fun := uninstantiated(ce.Fun)
+	for {
+		pe, ok := fun.(*dst.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = uninstantiated(pe.X)
+	}
+
+	var ident *dst.Ident
+	switch f := fun.(type) {
+	case *dst.Ident:
+		ident = f
+	case *dst.SelectorExpr:
+		ident = f.Sel
+	default:
+		return nil
+	}
+	fn, _ := pkg.ObjectOf(ident).(*types.Func)
+	return fn
+}
+
+// isSameFunc checks if the functions are the same one, methods of instantiated generic types, like
+// S[int].Add, are the same as the ones declared, like S[T].Add
+func isSameFunc(a, b *types.Func) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a == b || (a.Pos().IsValid() && a.Pos() == b.Pos() && a.Name() == b.Name())
+}
+
+func isInterfaceMethod(fn *types.Func) bool {
+	recv := fn.Type().(*types.Signature).Recv()
+	return recv != nil && types.IsInterface(recv.Type())
+}
+
+// findImplementations finds the methods, of the types declared in pkgs, implementing the interface method
+func findImplementations(pkgs []*Package, method *types.Func) (methods []*types.Func) {
+	iface, ok := method.Type().(*types.Signature).Recv().Type().Underlying().(*types.Interface)
+	if !ok {
+		return
+	}
+
+	for _, named := range findImplementers(pkgs, iface) {
+		obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), false, method.Pkg(), method.Name())
+		if fn, ok := obj.(*types.Func); ok {
+			methods = append(methods, fn)
+		}
+	}
+	return
+}
@@ -0,0 +1,184 @@
+package gorefactor
+
+import (
+	"bytes"
+	"github.com/dave/dst"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCallGraph(t *testing.T) {
+	var srcDB = `
+	package db
+
+	type Querier interface {
+		Query(q string) error
+	}
+
+	type DB struct{}
+
+	func (d *DB) Query(q string) error { return nil }
+
+	type Mock struct{}
+
+	func (m Mock) Query(q string) error { return nil }
+
+	func Open() *DB { return &DB{} }
+	`
+
+	var srcApp = `
+	package app
+
+	import "example.com/db"
+
+	func load(q db.Querier) {
+		q.Query("select")
+	}
+
+	func save() {
+		db.Open().Query("insert")
+	}
+
+	func handler() {
+		load(nil)
+	}
+
+	func lazy() {
+		f := func() {
+			handler()
+		}
+		f()
+	}
+
+	func main() {
+		lazy()
+		other()
+	}
+
+	func other() {}
+	`
+
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/db":  {"db.go": []byte(srcDB)},
+		"example.com/app": {"app.go": []byte(srcApp)},
+	})
+	assert.Nil(t, err)
+	g := BuildCallGraph(pkgs)
+
+	names := func(callers []Caller) (ret []string) {
+		for _, caller := range callers {
+			ret = append(ret, caller.Scope.FuncName)
+		}
+		return
+	}
+
+	assert.Equal(t, []string{"load"}, names(g.Callers("(example.com/db.Querier).Query")))
+	assert.Equal(t, []string{"load", "save"}, names(g.Callers("(*example.com/db.DB).Query")))
+	assert.Equal(t, []string{"load"}, names(g.Callers("(example.com/db.Mock).Query")))
+	assert.Equal(t, []string{"save"}, names(g.Callers("example.com/db.Open")))
+	assert.Equal(t, []string{"load", "handler", "lazy", "main"}, names(g.TransitiveCallers("(example.com/db.Mock).Query")))
+	assert.Nil(t, g.TransitiveCallers("example.com/app.main"))
+	assert.Nil(t, g.Callers("example.com/app.missing"))
+
+	callers := g.TransitiveCallers("example.com/app.handler")
+	assert.Equal(t, []string{"lazy", "main"}, names(callers))
+	assert.Equal(t, pkgs[0], callers[0].Package)
+	assert.Equal(t, pkgs[0].Files[0], callers[0].File)
+}
+
+func TestCallGraphGeneric(t *testing.T) {
+	var src = `
+	package m
+
+	type S[T any] struct{ items []T }
+
+	func (s *S[T]) Add(item T) { s.items = append(s.items, item) }
+
+	func Map[T, U any](ts []T, f func(T) U) []U { return nil }
+
+	func ints() {
+		s := &S[int]{}
+		s.Add(1)
+		Map([]int{1}, func(i int) string { return "" })
+	}
+
+	func strs() {
+		var s S[string]
+		s.Add("a")
+		Map[string, int](nil, nil)
+	}
+	`
+
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/m": {"m.go": []byte(src)},
+	})
+	assert.Nil(t, err)
+	g := BuildCallGraph(pkgs)
+
+	names := func(callers []Caller) (ret []string) {
+		for _, caller := range callers {
+			ret = append(ret, caller.Scope.FuncName)
+		}
+		return
+	}
+
+	assert.Equal(t, []string{"ints", "strs"}, names(g.Callers("(*example.com/m.S[T]).Add")))
+	assert.Equal(t, []string{"ints", "strs"}, names(g.Callers("example.com/m.Map")))
+	assert.Nil(t, g.Callers("(*example.com/m.S[int]).Add"))
+}
+
+func TestCallerScope(t *testing.T) {
+	var src = `
+	package app
+
+	type A struct{}
+
+	func (a A) Close() { query("a") }
+
+	type B struct{}
+
+	func (b B) Close() { b.query("b") }
+
+	func (b B) query(q string) {}
+
+	func query(q string) {}
+
+	func main() {
+		A{}.Close()
+	}
+	`
+
+	var expected = `
+	package app
+
+	type A struct{}
+
+	func (a A) Close() { query("a", ctx) }
+
+	type B struct{}
+
+	func (b B) Close() { b.query("b") }
+
+	func (b B) query(q string) {}
+
+	func query(q string) {}
+
+	func main() {
+		A{}.Close()
+	}
+	`
+
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/app": {"app.go": []byte(src)},
+	})
+	assert.Nil(t, err)
+	pkg := pkgs[0]
+
+	callers := BuildCallGraph(pkgs).Callers("example.com/app.query")
+	assert.Len(t, callers, 1)
+	assert.True(t, AddArgToCallExpr(callers[0].File, callers[0].Scope, "query", dst.NewIdent("ctx"), -1))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, expected, buf.String())
+}
@@ -0,0 +1,566 @@
+package gorefactor
+
+import (
+	"fmt"
+	"github.com/dave/dst"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MoveDecl moves the top level declaration of given name, a function, type, var or const, from package
+// from to the file toFile of package to. A type is moved together with its methods. If the declaration
+// is still referenced from outside of package to, it's exported when necessary. References in all pkgs
+// are rewritten to the new import path, imports of the files are fixed when they are printed.
+func MoveDecl(pkgs []*Package, from *Package, name string, to *Package, toFile *dst.File) error {
+	obj := from.Types.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("%s is not declared in package %s", name, from.PkgPath)
+	}
+
+	moved := findDecls(from, name)
+	if len(moved) == 0 {
+		return fmt.Errorf("declaration of %s not found in package %s", name, from.PkgPath)
+	}
+
+	for _, md := range moved {
+		if gd, ok := md.decl.(*dst.GenDecl); ok {
+			if vs, ok := gd.Specs[0].(*dst.ValueSpec); ok && len(vs.Names) > 1 {
+				return fmt.Errorf("%s is declared together with other names", name)
+			}
+		}
+		if md.group != nil && usesIota(md.group) {
+			return fmt.Errorf("%s is declared in a const group depending on iota", name)
+		}
+	}
+
+	members := memberObjects(obj)
+	insideMoved := make(map[*dst.Ident]bool)
+	var usesFrom bool
+	for _, md := range moved {
+		var err error
+		dst.Inspect(md.decl, func(n dst.Node) bool {
+			ident, ok := n.(*dst.Ident)
+			if !ok || err != nil {
+				return true
+			}
+			insideMoved[ident] = true
+
+			ref := from.ObjectOf(ident)
+			if ref == nil || ref == obj || ref.Pkg() != from.Types || ref.Parent() != from.Types.Scope() {
+				return true
+			}
+			if !ref.Exported() {
+				err = fmt.Errorf("%s references unexported %s of package %s", name, ref.Name(), from.PkgPath)
+			}
+			usesFrom = true
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// collect references to the declaration before anything is changed
+	refs := make(map[*dst.Ident]*Package)
+	users := make(map[*Package]bool)
+	for _, pkg := range pkgs {
+		for _, df := range pkg.Files {
+			var err error
+			dst.Inspect(df, func(n dst.Node) bool {
+				ident, ok := n.(*dst.Ident)
+				if !ok || err != nil || insideMoved[ident] {
+					return true
+				}
+
+				ref := pkg.ObjectOf(ident)
+				if ref == obj {
+					refs[ident] = pkg
+					if pkg != to {
+						users[pkg] = true
+					}
+				} else if members[ref] && !ref.Exported() && pkg != to {
+					err = fmt.Errorf("unexported %s of %s is referenced outside package %s", ref.Name(), name, to.PkgPath)
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// package to imports package from afterwards, if the declaration moved uses it
+	if usesFrom && from != to && importsPackage(from.Types, to.Types, make(map[*types.Package]bool)) {
+		return fmt.Errorf("moving %s to package %s introduces an import cycle", name, to.PkgPath)
+	}
+
+	// every package still using the declaration imports package to afterwards
+	for pkg := range users {
+		if importsPackage(to.Types, pkg.Types, make(map[*types.Package]bool)) || (pkg == from && usesFrom) {
+			return fmt.Errorf("moving %s to package %s introduces an import cycle", name, to.PkgPath)
+		}
+	}
+
+	newName := name
+	if len(users) > 0 && !obj.Exported() {
+		newName = exportedName(name)
+	}
+	if from != to && to.Types.Scope().Lookup(newName) != nil {
+		return fmt.Errorf("%s is already declared in package %s", newName, to.PkgPath)
+	}
+
+	for ident, pkg := range refs {
+		ident.Name = newName
+		if pkg == to {
+			ident.Path = ""
+		} else {
+			ident.Path = to.PkgPath
+		}
+	}
+
+	for _, md := range moved {
+		dst.Inspect(md.decl, func(n dst.Node) bool {
+			ident, ok := n.(*dst.Ident)
+			if !ok {
+				return true
+			}
+
+			ref := from.ObjectOf(ident)
+			switch {
+			case ref == obj:
+				ident.Name = newName
+			case ident.Path == to.PkgPath:
+				ident.Path = ""
+			case ref != nil && ref.Pkg() == from.Types && ref.Parent() == from.Types.Scope() && ident.Path == "":
+				ident.Path = from.PkgPath
+			}
+			return true
+		})
+
+		md.remove()
+		md.decl.Decorations().Before = dst.EmptyLine
+		toFile.Decls = append(toFile.Decls, md.decl)
+	}
+	return nil
+}
+
+// RemovedDecl is a declaration removed as dead code
+type RemovedDecl struct {
+	// Tok is one of token.FUNC, token.TYPE, token.CONST, token.VAR and token.IMPORT
+	Tok token.Token
+	// Name is the name declared, names separated by comma, "T.m" for a method, or the path of an import
+	Name     string
+	Filename string
+}
+
+// RemoveDeadCode removes the unexported functions, types, consts and vars, that are not referenced by
+// the rest of the package, together with the imports not used any more, and reports what's removed.
+// Declarations only referenced by each other are removed too, so are the methods of a removed type.
+// Vars initialized with values that may have side effects, and consts in a group depending on iota,
+// are kept. Test files are not loaded with the package, so for a package loaded from a dir, declarations
+// whose names are referred in the in-package _test.go files of the dir are kept as well.
+func RemoveDeadCode(pkg *Package) (removed []RemovedDecl) {
+	// a unit is a top level function, method or spec, which is live if any object it declares is live
+	type unit struct {
+		df     *dst.File
+		node   dst.Node
+		tok    token.Token
+		name   string
+		owners []types.Object
+		root   bool
+		remove func()
+	}
+
+	var units []*unit
+	for _, df := range pkg.Files {
+		df := df
+		for _, decl := range df.Decls {
+			switch dd := decl.(type) {
+			case *dst.FuncDecl:
+				u := &unit{df: df, node: dd, tok: token.FUNC, name: dd.Name.Name, remove: func() { removeDecl(df, dd) }}
+				if dd.Recv != nil {
+					typeName := receiverTypeName(dd)
+					u.name = typeName + "." + dd.Name.Name
+					if obj := pkg.Types.Scope().Lookup(typeName); obj != nil {
+						u.owners = append(u.owners, obj)
+					}
+				} else if obj := pkg.ObjectOf(dd.Name); obj != nil {
+					u.owners = append(u.owners, obj)
+				}
+				u.root = dd.Name.Name == "init" || (dd.Name.Name == "main" && pkg.Name == "main")
+				units = append(units, u)
+			case *dst.GenDecl:
+				if dd.Tok == token.IMPORT {
+					continue
+				}
+
+				groupUsesIota := usesIota(dd)
+
+				for _, spec := range dd.Specs {
+					spec := spec
+					u := &unit{df: df, node: spec, tok: dd.Tok, remove: func() {
+						removeSpec(dd, spec)
+						if len(dd.Specs) == 0 {
+							removeDecl(df, dd)
+						}
+					}}
+					var names []string
+					switch ss := spec.(type) {
+					case *dst.TypeSpec:
+						names = append(names, ss.Name.Name)
+						u.owners = append(u.owners, pkg.ObjectOf(ss.Name))
+					case *dst.ValueSpec:
+						for _, ident := range ss.Names {
+							names = append(names, ident.Name)
+							u.owners = append(u.owners, pkg.ObjectOf(ident))
+						}
+						for _, value := range ss.Values {
+							u.root = u.root || !isSideEffectFree(value)
+						}
+						u.root = u.root || groupUsesIota
+					}
+					u.name = strings.Join(names, ", ")
+					units = append(units, u)
+				}
+			}
+		}
+	}
+
+	usedInTests := namesUsedInTests(pkg)
+	for _, u := range units {
+		for _, obj := range u.owners {
+			u.root = u.root || (obj != nil && usedInTests[obj.Name()])
+		}
+	}
+
+	isCandidate := func(obj types.Object) bool {
+		return obj != nil && obj.Pkg() == pkg.Types && obj.Parent() == pkg.Types.Scope() &&
+			!obj.Exported() && obj.Name() != "_"
+	}
+
+	candidates := make(map[types.Object]bool)
+	owned := make(map[types.Object][]*unit)
+	for _, u := range units {
+		if len(u.owners) == 0 {
+			u.root = true
+		}
+		for _, obj := range u.owners {
+			if isCandidate(obj) {
+				candidates[obj] = true
+				owned[obj] = append(owned[obj], u)
+			} else {
+				u.root = true
+			}
+		}
+	}
+
+	// objects referenced, directly or indirectly, from the roots are live
+	live := make(map[types.Object]bool)
+	visited := make(map[*unit]bool)
+	var queue []*unit
+	for _, u := range units {
+		if u.root {
+			visited[u] = true
+			queue = append(queue, u)
+		}
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		dst.Inspect(u.node, func(n dst.Node) bool {
+			ident, ok := n.(*dst.Ident)
+			if !ok {
+				return true
+			}
+			obj := pkg.ObjectOf(ident)
+			if !candidates[obj] || live[obj] {
+				return true
+			}
+			live[obj] = true
+			for _, ou := range owned[obj] {
+				if !visited[ou] {
+					visited[ou] = true
+					queue = append(queue, ou)
+				}
+			}
+			return true
+		})
+	}
+
+	for _, u := range units {
+		if visited[u] {
+			continue
+		}
+		u.remove()
+		removed = append(removed, RemovedDecl{Tok: u.tok, Name: u.name, Filename: pkg.Filename(u.df)})
+	}
+
+	for _, df := range pkg.Files {
+		for _, path := range removeUnusedImports(df) {
+			removed = append(removed, RemovedDecl{Tok: token.IMPORT, Name: path, Filename: pkg.Filename(df)})
+		}
+	}
+	return
+}
+
+// namesUsedInTests returns the names of identifiers in the _test.go files, of the same package, in the
+// dir the package is loaded from. The files are only parsed, as they may depend on packages not loaded.
+func namesUsedInTests(pkg *Package) map[string]bool {
+	names := make(map[string]bool)
+	if pkg.Dir == "" {
+		return names
+	}
+	files, err := ioutil.ReadDir(pkg.Dir)
+	if err != nil {
+		return names
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(pkg.Dir, name); err != nil || !ok {
+			continue
+		}
+		af, err := parser.ParseFile(token.NewFileSet(), filepath.Join(pkg.Dir, name), nil, 0)
+		if err != nil || af.Name.Name != pkg.Name {
+			continue
+		}
+		ast.Inspect(af, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// usesIota checks if the const group depends on iota, either explicitly or by omitting values which
+// repeat the previous ones, so that its specs can't be told apart
+func usesIota(gd *dst.GenDecl) (ret bool) {
+	if gd.Tok != token.CONST {
+		return
+	}
+	for _, spec := range gd.Specs {
+		vs := spec.(*dst.ValueSpec)
+		ret = ret || len(vs.Values) == 0
+		dst.Inspect(vs, func(n dst.Node) bool {
+			ident, ok := n.(*dst.Ident)
+			ret = ret || (ok && ident.Path == "" && ident.Name == "iota")
+			return !ret
+		})
+	}
+	return
+}
+
+// isSideEffectFree checks if evaluating the expression, e.g. to initialize a var, has no side effects
+func isSideEffectFree(expr dst.Expr) bool {
+	switch e := expr.(type) {
+	case *dst.FuncLit:
+		return true
+	case *dst.CompositeLit:
+		for _, elt := range e.Elts {
+			if !isSideEffectFree(elt) {
+				return false
+			}
+		}
+		return true
+	case *dst.KeyValueExpr:
+		return isSideEffectFree(e.Key) && isSideEffectFree(e.Value)
+	case *dst.BinaryExpr:
+		return isSideEffectFree(e.X) && isSideEffectFree(e.Y)
+	case *dst.UnaryExpr:
+		return e.Op != token.ARROW && isSideEffectFree(e.X)
+	}
+	return isPureExpr(expr)
+}
+
+// removeUnusedImports removes the imports, except blank and dot imports, not referred in the file
+func removeUnusedImports(df *dst.File) (paths []string) {
+	used := make(map[string]bool)
+	for _, decl := range df.Decls {
+		if gd, ok := decl.(*dst.GenDecl); ok && gd.Tok == token.IMPORT {
+			continue
+		}
+		dst.Inspect(decl, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok && ident.Path != "" {
+				used[ident.Path] = true
+			}
+			return true
+		})
+	}
+
+	var imports []*dst.ImportSpec
+	for _, is := range df.Imports {
+		path, err := strconv.Unquote(is.Path.Value)
+		if err != nil || used[path] || (is.Name != nil && (is.Name.Name == "_" || is.Name.Name == ".")) {
+			imports = append(imports, is)
+			continue
+		}
+
+		paths = append(paths, path)
+		for _, decl := range df.Decls {
+			if gd, ok := decl.(*dst.GenDecl); ok && gd.Tok == token.IMPORT {
+				removeSpec(gd, is)
+				if len(gd.Specs) == 0 {
+					removeDecl(df, gd)
+				}
+			}
+		}
+	}
+	df.Imports = imports
+	return
+}
+
+// movedDecl is a top level declaration to be moved, remove deletes it from where it's declared
+type movedDecl struct {
+	decl   dst.Decl
+	remove func()
+	// group is the declaration the spec is split out of, if any
+	group *dst.GenDecl
+}
+
+// findDecls finds the top level declaration of the given name, together with methods if it's a type
+func findDecls(pkg *Package, name string) (decls []movedDecl) {
+	for _, df := range pkg.Files {
+		df := df
+		for _, decl := range df.Decls {
+			switch dd := decl.(type) {
+			case *dst.FuncDecl:
+				if (dd.Recv == nil && dd.Name.Name == name) || (dd.Recv != nil && receiverTypeName(dd) == name) {
+					decls = append(decls, movedDecl{decl: dd, remove: func() { removeDecl(df, dd) }})
+				}
+			case *dst.GenDecl:
+				for _, spec := range dd.Specs {
+					spec := spec
+					if !specDeclares(spec, name) {
+						continue
+					}
+
+					if len(dd.Specs) == 1 {
+						decls = append(decls, movedDecl{decl: dd, remove: func() { removeDecl(df, dd) }})
+						break
+					}
+					gd := &dst.GenDecl{Tok: dd.Tok, Specs: []dst.Spec{spec}}
+					decls = append(decls, movedDecl{decl: gd, remove: func() { removeSpec(dd, spec) }, group: dd})
+				}
+			}
+		}
+	}
+	return
+}
+
+func specDeclares(spec dst.Spec, name string) bool {
+	switch ss := spec.(type) {
+	case *dst.TypeSpec:
+		return ss.Name.Name == name
+	case *dst.ValueSpec:
+		for _, ident := range ss.Names {
+			if ident.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func receiverTypeName(fd *dst.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return ""
+	}
+
+	expr := fd.Recv.List[0].Type
+	if se, ok := expr.(*dst.StarExpr); ok {
+		expr = se.X
+	}
+	// receivers of generic types, e.g. S[T] and M[K, V]
+	switch e := expr.(type) {
+	case *dst.IndexExpr:
+		expr = e.X
+	case *dst.IndexListExpr:
+		expr = e.X
+	}
+	if ident, ok := expr.(*dst.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+func removeDecl(df *dst.File, decl dst.Decl) {
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		if d != decl {
+			decls = append(decls, d)
+		}
+	}
+	df.Decls = decls
+}
+
+func removeSpec(gd *dst.GenDecl, spec dst.Spec) {
+	var specs []dst.Spec
+	for _, s := range gd.Specs {
+		if s != spec {
+			specs = append(specs, s)
+		}
+	}
+	gd.Specs = specs
+}
+
+// memberObjects returns the fields and methods of a named type
+func memberObjects(obj types.Object) map[types.Object]bool {
+	members := make(map[types.Object]bool)
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return members
+	}
+
+	named, ok := tn.Type().(*types.Named)
+	if !ok {
+		return members
+	}
+	for i := 0; i < named.NumMethods(); i++ {
+		members[named.Method(i)] = true
+	}
+	if st, ok := named.Underlying().(*types.Struct); ok {
+		for i := 0; i < st.NumFields(); i++ {
+			members[st.Field(i)] = true
+		}
+	}
+	return members
+}
+
+// importsPackage checks if package a imports package b, directly or indirectly
+func importsPackage(a, b *types.Package, seen map[*types.Package]bool) bool {
+	if seen[a] {
+		return false
+	}
+	seen[a] = true
+
+	for _, imp := range a.Imports() {
+		if imp == b || importsPackage(imp, b, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+func unexportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
@@ -0,0 +1,353 @@
+package gorefactor
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveDecl(t *testing.T) {
+	var srcA = `
+	package a
+
+	import (
+		"fmt"
+		"strings"
+	)
+
+	const Prefix = "> "
+
+	type client struct {
+		Name string
+	}
+
+	func (c *client) Hello() string {
+		return strings.ToUpper(c.Name)
+	}
+
+	func Greeting() string {
+		return Prefix
+	}
+
+	func Hello(name string) {
+		c := &client{Name: name}
+		fmt.Println(Greeting() + c.Hello())
+	}
+	`
+
+	var srcB = `
+	package b
+
+	func Bye() {}
+	`
+
+	var srcC = `
+	package c
+
+	import "example.com/a"
+
+	func Hello() {
+		a.Hello("c")
+	}
+	`
+
+	t.Run("move type with methods", func(t *testing.T) {
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/b": {"b.go": []byte(srcB)},
+			"example.com/c": {"c.go": []byte(srcC)},
+		})
+		assert.Nil(t, err)
+		a, b := pkgs[0], pkgs[1]
+
+		assert.Nil(t, MoveDecl(pkgs, a, "client", b, b.Files[0]))
+
+		var expectedA = `
+		package a
+
+		import (
+			"fmt"
+
+			"example.com/b"
+		)
+
+		const Prefix = "> "
+
+		func Greeting() string {
+			return Prefix
+		}
+
+		func Hello(name string) {
+			c := &b.Client{Name: name}
+			fmt.Println(Greeting() + c.Hello())
+		}
+		`
+
+		var expectedB = `
+		package b
+
+		import "strings"
+
+		func Bye() {}
+
+		type Client struct {
+			Name string
+		}
+
+		func (c *Client) Hello() string {
+			return strings.ToUpper(c.Name)
+		}
+		`
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, a.Fprint(buf, a.Files[0]))
+		assertCodesEqual(t, expectedA, buf.String())
+
+		buf = bytes.NewBuffer([]byte{})
+		assert.Nil(t, b.Fprint(buf, b.Files[0]))
+		assertCodesEqual(t, expectedB, buf.String())
+	})
+
+	t.Run("move function and rewrite references", func(t *testing.T) {
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/b": {"b.go": []byte(srcB)},
+			"example.com/c": {"c.go": []byte(srcC)},
+		})
+		assert.Nil(t, err)
+		a, b, c := pkgs[0], pkgs[1], pkgs[2]
+
+		assert.Nil(t, MoveDecl(pkgs, a, "Prefix", b, b.Files[0]))
+		assert.NotNil(t, MoveDecl(pkgs, a, "Hello", b, b.Files[0]), "Hello references unexported client")
+		assert.NotNil(t, MoveDecl(pkgs, a, "Missing", b, b.Files[0]))
+
+		var expectedC = `
+		package c
+
+		import "example.com/a"
+
+		func Hello() {
+			a.Hello("c")
+		}
+		`
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, c.Fprint(buf, c.Files[0]))
+		assertCodesEqual(t, expectedC, buf.String())
+
+		buf = bytes.NewBuffer([]byte{})
+		assert.Nil(t, a.Fprint(buf, a.Files[0]))
+		assert.Contains(t, buf.String(), "return b.Prefix")
+	})
+
+	t.Run("import cycle", func(t *testing.T) {
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/b": {"b.go": []byte(srcB)},
+			"example.com/c": {"c.go": []byte(srcC)},
+		})
+		assert.Nil(t, err)
+		a, b, c := pkgs[0], pkgs[1], pkgs[2]
+
+		assert.NotNil(t, MoveDecl(pkgs, a, "Greeting", b, b.Files[0]))
+		assert.NotNil(t, MoveDecl(pkgs, a, "Prefix", c, c.Files[0]))
+	})
+
+	t.Run("import cycle through the moved declaration", func(t *testing.T) {
+		var srcD = `
+		package d
+
+		import "example.com/a"
+
+		const X = "x"
+
+		func Hello() { a.Hello(X) }
+
+		func helper() string { return X }
+		`
+
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/d": {"d.go": []byte(srcD)},
+		})
+		assert.Nil(t, err)
+		a, d := pkgs[0], pkgs[1]
+
+		assert.NotNil(t, MoveDecl(pkgs, d, "helper", a, a.Files[0]))
+	})
+
+	t.Run("const group depending on iota", func(t *testing.T) {
+		var srcD = `
+		package d
+
+		const (
+			Red = iota
+			Green
+			Blue
+		)
+
+		const (
+			Small = 1
+			Large = 2
+		)
+		`
+
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/d": {"d.go": []byte(srcD)},
+		})
+		assert.Nil(t, err)
+		a, d := pkgs[0], pkgs[1]
+
+		assert.NotNil(t, MoveDecl(pkgs, d, "Green", a, a.Files[0]))
+		assert.NotNil(t, MoveDecl(pkgs, d, "Red", a, a.Files[0]))
+		assert.Nil(t, MoveDecl(pkgs, d, "Large", a, a.Files[0]))
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, d.Fprint(buf, d.Files[0]))
+		assertCodesEqual(t, `
+		package d
+
+		const (
+			Red = iota
+			Green
+			Blue
+		)
+
+		const (
+			Small = 1
+		)
+		`, buf.String())
+	})
+}
+
+func TestRemoveDeadCode(t *testing.T) {
+	var src = `
+	package a
+
+	import (
+		"fmt"
+		"strings"
+	)
+
+	const (
+		red = iota
+		green
+	)
+
+	const prefix, suffix = "> ", " <"
+
+	var registered = register()
+
+	var cache = map[string]string{}
+
+	type client struct{}
+
+	func (c *client) hello() string {
+		return strings.ToUpper(helper())
+	}
+
+	func helper() string { return prefix }
+
+	func ping() { pong() }
+
+	func pong() { ping() }
+
+	func register() bool { return true }
+
+	func Hello() {
+		fmt.Println(suffix)
+	}
+	`
+
+	var expected = `
+	package a
+
+	import (
+		"fmt"
+	)
+
+	const (
+		red = iota
+		green
+	)
+
+	const prefix, suffix = "> ", " <"
+
+	var registered = register()
+
+	func register() bool { return true }
+
+	func Hello() {
+		fmt.Println(suffix)
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(src)})
+	assert.Nil(t, err)
+
+	var removed []string
+	for _, rd := range RemoveDeadCode(pkg) {
+		assert.Equal(t, "a.go", rd.Filename)
+		removed = append(removed, rd.Tok.String()+" "+rd.Name)
+	}
+	assert.Equal(t, []string{
+		"var cache",
+		"type client",
+		"func client.hello",
+		"func helper",
+		"func ping",
+		"func pong",
+		"import strings",
+	}, removed)
+	assert.Nil(t, RemoveDeadCode(pkg))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, expected, buf.String())
+}
+
+func TestRemoveDeadCodeUsedInTests(t *testing.T) {
+	var src = `
+	package a
+
+	type client struct{}
+
+	func (c *client) reset() {}
+
+	func helper() int { return 1 }
+
+	func unused() {}
+	`
+
+	var srcTest = `
+	package a
+
+	import "testing"
+
+	func TestHelper(t *testing.T) {
+		c := &client{}
+		c.reset()
+		_ = helper()
+	}
+	`
+
+	dir, err := ioutil.TempDir("", "gorefactor")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a_test.go"), []byte(srcTest), 0644))
+
+	pkg, err := LoadPackage("example.com/a", dir)
+	assert.Nil(t, err)
+
+	var names []string
+	for _, rd := range RemoveDeadCode(pkg) {
+		names = append(names, rd.Name)
+	}
+	assert.Equal(t, []string{"unused"}, names)
+}
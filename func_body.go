@@ -1,8 +1,12 @@
 package gorefactor
 
 import (
+	"fmt"
 	"github.com/dave/dst"
 	"github.com/dave/dst/dstutil"
+	"go/ast"
+	"go/token"
+	"go/types"
 )
 
 // HasStmtInsideFuncBody checks if the body of function has given statement
@@ -126,6 +130,12 @@ func DeleteSelectorExprFromFuncBody(df *dst.File, funcName string, selectorExpr
 
 // AddStmtToFuncBody adds given statement, to the body of function, in the given position
 func AddStmtToFuncBody(df *dst.File, funcName string, stmt dst.Stmt, pos int) (modified bool) {
+	return AddStmtsToFuncBody(df, funcName, []dst.Stmt{stmt}, pos)
+}
+
+// AddStmtsToFuncBody adds given statements, in order, to the body of function, in the given position.
+// The statements can be parsed from a snippet with ParseStmts, and decorated with DecorateStmts.
+func AddStmtsToFuncBody(df *dst.File, funcName string, stmts []dst.Stmt, pos int) (modified bool) {
 	pre := func(c *dstutil.Cursor) bool {
 		node := c.Node()
 
@@ -135,10 +145,12 @@ func AddStmtToFuncBody(df *dst.File, funcName string, stmt dst.Stmt, pos int) (m
 				stmtList := nn.Body.List
 				pos = normalizePos(pos, len(stmtList))
 
-				nn.Body.List = append(
-					stmtList[:pos],
-					append([]dst.Stmt{dst.Clone(stmt).(dst.Stmt)}, stmtList[pos:]...)...)
-				modified = true
+				var added []dst.Stmt
+				for _, stmt := range stmts {
+					added = append(added, dst.Clone(stmt).(dst.Stmt))
+				}
+				nn.Body.List = append(stmtList[:pos], append(added, stmtList[pos:]...)...)
+				modified = len(added) > 0
 				return false
 			}
 		}
@@ -149,6 +161,43 @@ func AddStmtToFuncBody(df *dst.File, funcName string, stmt dst.Stmt, pos int) (m
 	return
 }
 
+// StmtsDecs decorates a block of statements as a whole
+type StmtsDecs struct {
+	// Comments are put before the first statement, e.g. "// start tracing"
+	Comments []string
+	// EmptyLineBefore and EmptyLineAfter separate the block from the statements around
+	EmptyLineBefore bool
+	EmptyLineAfter  bool
+}
+
+// DecorateStmts attaches the decorations to the block of statements, and returns them
+func DecorateStmts(stmts []dst.Stmt, decs StmtsDecs) []dst.Stmt {
+	if len(stmts) == 0 {
+		return stmts
+	}
+
+	first, last := stmts[0].Decorations(), stmts[len(stmts)-1].Decorations()
+	first.Start.Prepend(decs.Comments...)
+	if decs.EmptyLineBefore {
+		first.Before = dst.EmptyLine
+	} else if len(decs.Comments) > 0 {
+		first.Before = dst.NewLine
+	}
+	if decs.EmptyLineAfter {
+		last.After = dst.EmptyLine
+	}
+	return stmts
+}
+
+// EnsureStmtInFuncBody adds given statement, to the body of function, in the given position, unless
+// the body already has it
+func EnsureStmtInFuncBody(df *dst.File, funcName string, stmt dst.Stmt, pos int) (modified bool) {
+	if HasStmtInsideFuncBody(df, funcName, stmt) {
+		return
+	}
+	return AddStmtToFuncBody(df, funcName, stmt, pos)
+}
+
 // AddStmtToFuncBodyStart adds given statement, to the start of function body
 func AddStmtToFuncBodyStart(df *dst.File, funcName string, stmt dst.Stmt) (modified bool) {
 	return AddStmtToFuncBody(df, funcName, stmt, 0)
@@ -165,44 +214,53 @@ const (
 )
 
 func addStmtToFuncBodyRelativeTo(df *dst.File, funcName string, stmt, refStmt dst.Stmt, relDirection int) (modified bool) {
-	var inside bool
-	pre := func(c *dstutil.Cursor) bool {
-		node := c.Node()
+	return addStmtsToFuncBodyAt(df, funcName, []dst.Stmt{stmt}, StmtAnchor(refStmt, AllOccurrences), relDirection)
+}
 
-		switch node.(type) {
-		case *dst.FuncDecl:
-			if nn := node.(*dst.FuncDecl); nn.Name.Name == funcName {
-				inside = true
-			}
-		case dst.Stmt:
-			ss := node.(dst.Stmt)
-			if inside && nodesEqual(ss, refStmt) {
-				switch relDirection {
-				case relativeDirectionBefore:
-					c.InsertBefore(dst.Clone(stmt))
-					modified = true
-				case relativeDirectionAfter:
-					c.InsertAfter(dst.Clone(stmt))
-					modified = true
-				}
+// addStmtsToFuncBodyAt adds the statements relative to the anchored ones, in the body of every function
+// or method of the given name
+func addStmtsToFuncBodyAt(df *dst.File, funcName string, stmts []dst.Stmt, anchor Anchor, relDirection int) (modified bool) {
+	if len(stmts) == 0 {
+		return
+	}
+
+	anchored := make(map[dst.Stmt]bool)
+	var bodies []*dst.BlockStmt
+	for _, decl := range df.Decls {
+		if fd, ok := decl.(*dst.FuncDecl); ok && fd.Name.Name == funcName && fd.Body != nil {
+			for _, stmt := range anchor.find(fd.Body) {
+				anchored[stmt] = true
 			}
+			bodies = append(bodies, fd.Body)
 		}
-		return true
+	}
+	if len(anchored) == 0 {
+		return
 	}
 
-	post := func(c *dstutil.Cursor) bool {
-		node := c.Node()
+	pre := func(c *dstutil.Cursor) bool {
+		node, ok := c.Node().(dst.Stmt)
+		if !ok || !anchored[node] {
+			return true
+		}
 
-		switch node.(type) {
-		case *dst.FuncDecl:
-			if nn := node.(*dst.FuncDecl); nn.Name.Name == funcName && inside {
-				inside = false
+		switch relDirection {
+		case relativeDirectionBefore:
+			for _, stmt := range stmts {
+				c.InsertBefore(dst.Clone(stmt))
+			}
+		case relativeDirectionAfter:
+			for i := len(stmts) - 1; i >= 0; i-- {
+				c.InsertAfter(dst.Clone(stmts[i]))
 			}
 		}
+		modified = true
 		return true
 	}
 
-	dstutil.Apply(df, pre, post)
+	for _, body := range bodies {
+		dstutil.Apply(body, pre, nil)
+	}
 	return
 }
 
@@ -217,3 +275,669 @@ func AddStmtToFuncBodyBefore(df *dst.File, funcName string, stmt, refStmt dst.St
 func AddStmtToFuncBodyAfter(df *dst.File, funcName string, stmt, refStmt dst.Stmt) (modified bool) {
 	return addStmtToFuncBodyRelativeTo(df, funcName, stmt, refStmt, relativeDirectionAfter)
 }
+
+// AddStmtsToFuncBodyBeforeAnchor adds given statements, in order, to the function body, before the
+// statements matched by the anchor
+func AddStmtsToFuncBodyBeforeAnchor(df *dst.File, funcName string, stmts []dst.Stmt, anchor Anchor) (modified bool) {
+	return addStmtsToFuncBodyAt(df, funcName, stmts, anchor, relativeDirectionBefore)
+}
+
+// AddStmtsToFuncBodyAfterAnchor adds given statements, in order, to the function body, after the
+// statements matched by the anchor
+func AddStmtsToFuncBodyAfterAnchor(df *dst.File, funcName string, stmts []dst.Stmt, anchor Anchor) (modified bool) {
+	return addStmtsToFuncBodyAt(df, funcName, stmts, anchor, relativeDirectionAfter)
+}
+
+// AddStmtBeforeReturns adds given statement before every exit path of the functions in scope, i.e. the
+// return statements, excluding the ones in function literals, and the end of body of a function without
+// results. If evalResults is true, results of a return statement that may have side effects, like
+// `return f()`, are evaluated into the named results, or temporaries if the results are unnamed or shadowed,
+// before the statement, so that it runs after the evaluation.
+func AddStmtBeforeReturns(df *dst.File, scope Scope, stmt dst.Stmt, evalResults bool) (modified bool) {
+	pre := func(c *dstutil.Cursor) bool {
+		fd, ok := c.Node().(*dst.FuncDecl)
+		if !ok {
+			return true
+		}
+		scope.TryEnterScope(fd)
+		defer scope.TryLeaveScope(fd)
+		if !scope.IsInScope() || fd.Body == nil {
+			return false
+		}
+
+		if addStmtBeforeReturns(fd, stmt, evalResults) {
+			modified = true
+		}
+		return false
+	}
+
+	dstutil.Apply(df, pre, nil)
+	return
+}
+
+func addStmtBeforeReturns(fd *dst.FuncDecl, stmt dst.Stmt, evalResults bool) (modified bool) {
+	returns := make(map[dst.Stmt]bool)
+	for _, ret := range ReturnAnchor(AllOccurrences).find(fd.Body) {
+		returns[ret] = true
+	}
+
+	pre := func(c *dstutil.Cursor) bool {
+		ret, ok := c.Node().(*dst.ReturnStmt)
+		if !ok || !returns[ret] {
+			return true
+		}
+
+		if evalResults {
+			for _, eval := range evalReturnResults(fd, ret) {
+				c.InsertBefore(eval)
+			}
+		}
+		c.InsertBefore(dst.Clone(stmt))
+		modified = true
+		return true
+	}
+	dstutil.Apply(fd.Body, pre, nil)
+
+	list := fd.Body.List
+	if fd.Type.Results == nil || len(fd.Type.Results.List) == 0 {
+		if len(list) == 0 || !returns[list[len(list)-1]] {
+			fd.Body.List = append(list, dst.Clone(stmt).(dst.Stmt))
+			modified = true
+		}
+	}
+	return
+}
+
+// evalReturnResults rewrites the return statement to return the results evaluated by the returned
+// statements, or returns nil if the results are free of side effects. The results are evaluated into
+// the named results, or temporaries declared with the result types if the results are not named or
+// shadowed at the return statement.
+func evalReturnResults(fd *dst.FuncDecl, ret *dst.ReturnStmt) []dst.Stmt {
+	pure := true
+	for _, result := range ret.Results {
+		pure = pure && isPureExpr(result)
+	}
+	if pure {
+		return nil
+	}
+
+	var names []string
+	named := true
+	for _, field := range fd.Type.Results.List {
+		if len(field.Names) == 0 {
+			named = false
+			names = append(names, "")
+		}
+		for _, ident := range field.Names {
+			named = named && ident.Name != "_"
+			names = append(names, ident.Name)
+		}
+	}
+	named = named && !isShadowedAt(fd, ret, names)
+
+	assign := &dst.AssignStmt{Tok: token.ASSIGN, Rhs: ret.Results}
+	var stmts []dst.Stmt
+	if !named {
+		used := make(map[string]bool)
+		dst.Inspect(fd, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok {
+				used[ident.Name] = true
+			}
+			return true
+		})
+		for i := range names {
+			names[i] = fmt.Sprintf("ret%d", i)
+			for j := 1; used[names[i]]; j++ {
+				names[i] = fmt.Sprintf("ret%d_%d", i, j)
+			}
+		}
+
+		// the temporaries are declared with the result types, as untyped results, like nil and
+		// constants, can't be assigned with :=, or would take the default types
+		gd := &dst.GenDecl{Tok: token.VAR}
+		i := 0
+		for _, field := range fd.Type.Results.List {
+			vs := &dst.ValueSpec{Type: dst.Clone(field.Type).(dst.Expr)}
+			for j := 0; j == 0 || j < len(field.Names); j++ {
+				vs.Names = append(vs.Names, dst.NewIdent(names[i]))
+				i++
+			}
+			gd.Specs = append(gd.Specs, vs)
+		}
+		gd.Lparen = len(gd.Specs) > 1
+		stmts = append(stmts, &dst.DeclStmt{Decl: gd})
+	}
+
+	ret.Results = nil
+	for _, name := range names {
+		assign.Lhs = append(assign.Lhs, dst.NewIdent(name))
+		if !named {
+			ret.Results = append(ret.Results, dst.NewIdent(name))
+		}
+	}
+	return append(stmts, assign)
+}
+
+// isShadowedAt checks if any of the names is declared again in the scopes, inside the function body,
+// the statement is in
+func isShadowedAt(fd *dst.FuncDecl, stmt dst.Stmt, names []string) bool {
+	var path []dst.Node
+	var found bool
+	dst.Inspect(fd.Body, func(n dst.Node) bool {
+		switch {
+		case found:
+			return false
+		case n == nil:
+			path = path[:len(path)-1]
+			return true
+		case n == stmt:
+			found = true
+			return false
+		}
+		path = append(path, n)
+		return true
+	})
+	if !found {
+		return false
+	}
+
+	declared := make(map[string]bool)
+	declare := func(stmt dst.Stmt) {
+		if stmt == nil {
+			return
+		}
+		for _, name := range declaredNames(stmt) {
+			declared[name] = true
+		}
+	}
+	declareBefore := func(list []dst.Stmt, child dst.Node) {
+		for _, stmt := range list {
+			if stmt == child {
+				break
+			}
+			declare(stmt)
+		}
+	}
+	for i, node := range path {
+		var child dst.Node = stmt
+		if i+1 < len(path) {
+			child = path[i+1]
+		}
+		switch nn := node.(type) {
+		case *dst.BlockStmt:
+			declareBefore(nn.List, child)
+		case *dst.CaseClause:
+			declareBefore(nn.Body, child)
+		case *dst.CommClause:
+			declare(nn.Comm)
+			declareBefore(nn.Body, child)
+		case *dst.IfStmt:
+			declare(nn.Init)
+		case *dst.ForStmt:
+			declare(nn.Init)
+		case *dst.SwitchStmt:
+			declare(nn.Init)
+		case *dst.TypeSwitchStmt:
+			declare(nn.Init)
+			declare(nn.Assign)
+		case *dst.RangeStmt:
+			if nn.Tok == token.DEFINE {
+				for _, expr := range []dst.Expr{nn.Key, nn.Value} {
+					if ident, ok := expr.(*dst.Ident); ok {
+						declared[ident.Name] = true
+					}
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		if declared[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaceStmtInFuncBody replaces every statement, inside the body of function, that is semantically
+// equal to oldStmt with newStmt
+func ReplaceStmtInFuncBody(df *dst.File, funcName string, oldStmt, newStmt dst.Stmt) (modified bool) {
+	return MutateStmts(df, Scope{FuncName: funcName}, func(stmt dst.Stmt) bool {
+		return nodesEqual(stmt, oldStmt)
+	}, func(stmt dst.Stmt) []dst.Stmt {
+		return []dst.Stmt{dst.Clone(newStmt).(dst.Stmt)}
+	})
+}
+
+// MutateStmts replaces every statement in scope, which satisfies the predicate, with the statements
+// returned by mutate, returning none deletes the statement. Only statements in statement lists, e.g.
+// blocks and case clauses, are visited, and the returned statements are not visited again.
+func MutateStmts(df *dst.File, scope Scope, predicate func(dst.Stmt) bool, mutate func(dst.Stmt) []dst.Stmt) (modified bool) {
+	pre := func(c *dstutil.Cursor) bool {
+		node := c.Node()
+
+		switch node.(type) {
+		case dst.Stmt:
+			nn := node.(dst.Stmt)
+			if !scope.IsInScope() || c.Index() < 0 || !predicate(nn) {
+				return true
+			}
+
+			for _, stmt := range mutate(nn) {
+				c.InsertBefore(stmt)
+			}
+			c.Delete()
+			modified = true
+			return false
+		default:
+			scope.TryEnterScope(node)
+		}
+		return true
+	}
+
+	post := func(c *dstutil.Cursor) bool {
+		scope.TryLeaveScope(c.Node())
+		return true
+	}
+
+	dstutil.Apply(df, pre, post)
+	return
+}
+
+// Wrapper builds the statement wrapping the given statements, e.g. an if statement with them as body
+type Wrapper func(stmts []dst.Stmt) dst.Stmt
+
+// WrapWithIf wraps statements in `if cond { ... }`
+func WrapWithIf(cond dst.Expr) Wrapper {
+	return func(stmts []dst.Stmt) dst.Stmt {
+		return &dst.IfStmt{Cond: dst.Clone(cond).(dst.Expr), Body: &dst.BlockStmt{List: stmts}}
+	}
+}
+
+// WrapWithFor wraps statements in `for cond { ... }`, or in an infinite loop if cond is nil
+func WrapWithFor(cond dst.Expr) Wrapper {
+	return func(stmts []dst.Stmt) dst.Stmt {
+		fs := &dst.ForStmt{Body: &dst.BlockStmt{List: stmts}}
+		if cond != nil {
+			fs.Cond = dst.Clone(cond).(dst.Expr)
+		}
+		return fs
+	}
+}
+
+// WrapWithBlock wraps statements in a block `{ ... }`
+func WrapWithBlock() Wrapper {
+	return func(stmts []dst.Stmt) dst.Stmt {
+		return &dst.BlockStmt{List: stmts}
+	}
+}
+
+// WrapWithClosure wraps statements in a closure called immediately, `func() { prologue; ... }()`,
+// e.g. with a deferred recover as prologue
+func WrapWithClosure(prologue ...dst.Stmt) Wrapper {
+	return func(stmts []dst.Stmt) dst.Stmt {
+		return &dst.ExprStmt{X: closureCall(prologue, stmts)}
+	}
+}
+
+// WrapWithGoroutine wraps statements in a closure run in a new goroutine, `go func() { prologue; ... }()`
+func WrapWithGoroutine(prologue ...dst.Stmt) Wrapper {
+	return func(stmts []dst.Stmt) dst.Stmt {
+		return &dst.GoStmt{Call: closureCall(prologue, stmts)}
+	}
+}
+
+func closureCall(prologue, stmts []dst.Stmt) *dst.CallExpr {
+	var body []dst.Stmt
+	for _, stmt := range prologue {
+		body = append(body, dst.Clone(stmt).(dst.Stmt))
+	}
+	return &dst.CallExpr{Fun: &dst.FuncLit{
+		Type: &dst.FuncType{Func: true, Params: &dst.FieldList{}},
+		Body: &dst.BlockStmt{List: append(body, stmts...)},
+	}}
+}
+
+// WrapStmts wraps the statements in scope, which satisfy the predicate, with the statement built by
+// wrap. Consecutive statements in the same statement list are wrapped together, the comments before
+// the first one and after the last one are moved onto the wrapping statement. Statements declaring
+// names used by the statements after them, e.g. `x := f()`, are left unwrapped, as the names would
+// go out of scope, and so are statements containing return, defer, or break, continue and goto out of
+// them, if they are wrapped in a function literal, like by WrapWithClosure and WrapWithGoroutine.
+func WrapStmts(df *dst.File, scope Scope, predicate func(dst.Stmt) bool, wrap Wrapper) (modified bool) {
+	wrapList := func(list []dst.Stmt) []dst.Stmt {
+		var newList, run []dst.Stmt
+		// flush wraps the run, unless names declared in it are used by the rest statements
+		flush := func(rest []dst.Stmt) {
+			if len(run) == 0 {
+				return
+			}
+			declared := make(map[string]bool)
+			for _, stmt := range run {
+				for _, name := range declaredNames(stmt) {
+					declared[name] = true
+				}
+			}
+			for _, stmt := range rest {
+				if refersToNames(stmt, declared) {
+					newList = append(newList, run...)
+					run = nil
+					return
+				}
+			}
+
+			// return, defer and branch statements would act on the closure instead
+			wrapper := wrap(run)
+			if isWrappedInFuncLit(wrapper, run[0]) && checkExtractable(run) != nil {
+				newList = append(newList, run...)
+				run = nil
+				return
+			}
+
+			first, last := run[0].Decorations(), run[len(run)-1].Decorations()
+			decs := wrapper.Decorations()
+			decs.Before, decs.Start = first.Before, first.Start
+			decs.After, decs.End = last.After, last.End
+			first.Before, first.Start = dst.NewLine, nil
+			last.After, last.End = dst.NewLine, nil
+
+			newList = append(newList, wrapper)
+			run = nil
+			modified = true
+		}
+
+		for i, stmt := range list {
+			if predicate(stmt) {
+				run = append(run, stmt)
+				continue
+			}
+			flush(list[i:])
+			newList = append(newList, stmt)
+		}
+		flush(nil)
+		return newList
+	}
+
+	pre := func(c *dstutil.Cursor) bool {
+		scope.TryEnterScope(c.Node())
+		return true
+	}
+
+	// statements are wrapped after their children, so that wrappers are never visited
+	post := func(c *dstutil.Cursor) bool {
+		node := c.Node()
+		if scope.IsInScope() {
+			switch nn := node.(type) {
+			case *dst.BlockStmt:
+				nn.List = wrapList(nn.List)
+			case *dst.CaseClause:
+				nn.Body = wrapList(nn.Body)
+			case *dst.CommClause:
+				nn.Body = wrapList(nn.Body)
+			}
+		}
+		scope.TryLeaveScope(node)
+		return true
+	}
+
+	dstutil.Apply(df, pre, post)
+	return
+}
+
+// isWrappedInFuncLit checks if the statement is wrapped in the body of a function literal by wrapper
+func isWrappedInFuncLit(wrapper dst.Stmt, stmt dst.Stmt) (ret bool) {
+	dst.Inspect(wrapper, func(n dst.Node) bool {
+		if fl, ok := n.(*dst.FuncLit); ok {
+			for _, s := range fl.Body.List {
+				ret = ret || s == stmt
+			}
+		}
+		return !ret
+	})
+	return
+}
+
+// ExtractStmtsFromFuncBody extracts the statements, in the body of function, of index [from, to)
+// into a new function named newFuncName, and replaces them with a call to it. Local variables
+// declared before the statements become the params of the new function, the ones declared or
+// assigned inside and used afterwards become the results.
+func ExtractStmtsFromFuncBody(pkg *Package, df *dst.File, funcName, newFuncName string, from, to int) error {
+	fd := findFuncDecl(df, funcName)
+	if fd == nil {
+		return fmt.Errorf("function %s not found", funcName)
+	}
+	if from < 0 || to > len(fd.Body.List) || from >= to {
+		return fmt.Errorf("invalid statement range [%d, %d) of function %s", from, to, funcName)
+	}
+
+	astFd, ok := pkg.dec.Ast.Nodes[fd].(*ast.FuncDecl)
+	if !ok {
+		return fmt.Errorf("function %s is not type checked", funcName)
+	}
+	first, ok1 := pkg.dec.Ast.Nodes[fd.Body.List[from]]
+	last, ok2 := pkg.dec.Ast.Nodes[fd.Body.List[to-1]]
+	if !ok1 || !ok2 {
+		return fmt.Errorf("statements of function %s are modified after type checked", funcName)
+	}
+	start, end := first.Pos(), last.End()
+
+	stmts := fd.Body.List[from:to]
+	if err := checkExtractable(stmts); err != nil {
+		return err
+	}
+
+	isLocal := func(v *types.Var) bool {
+		return !v.IsField() && v.Pkg() == pkg.Types && v.Pos() >= astFd.Pos() && v.Pos() < astFd.End()
+	}
+
+	var params, results []*types.Var
+	seen := make(map[*types.Var]bool)
+	assigned := make(map[*types.Var]bool)
+	for _, stmt := range stmts {
+		dst.Inspect(stmt, func(n dst.Node) bool {
+			switch nn := n.(type) {
+			case *dst.AssignStmt:
+				for _, lhs := range nn.Lhs {
+					if ident, ok := lhs.(*dst.Ident); ok {
+						if v, ok := pkg.ObjectOf(ident).(*types.Var); ok {
+							assigned[v] = true
+						}
+					}
+				}
+			case *dst.IncDecStmt:
+				if ident, ok := nn.X.(*dst.Ident); ok {
+					if v, ok := pkg.ObjectOf(ident).(*types.Var); ok {
+						assigned[v] = true
+					}
+				}
+			case *dst.Ident:
+				v, ok := pkg.ObjectOf(nn).(*types.Var)
+				if !ok || seen[v] || !isLocal(v) {
+					return true
+				}
+				seen[v] = true
+				if v.Pos() < start {
+					params = append(params, v)
+				}
+			}
+			return true
+		})
+	}
+
+	usedAfter := make(map[*types.Var]bool)
+	for _, stmt := range fd.Body.List[to:] {
+		dst.Inspect(stmt, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok {
+				if v, ok := pkg.ObjectOf(ident).(*types.Var); ok && seen[v] {
+					usedAfter[v] = true
+				}
+			}
+			return true
+		})
+	}
+
+	var define bool
+	for _, stmt := range stmts {
+		dst.Inspect(stmt, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok {
+				v, ok := pkg.ObjectOf(ident).(*types.Var)
+				if !ok || !usedAfter[v] || (v.Pos() < start && !assigned[v]) || containsVar(results, v) {
+					return true
+				}
+				if v.Pos() >= start && v.Pos() < end {
+					define = true
+				}
+				results = append(results, v)
+			}
+			return true
+		})
+	}
+
+	newFd := &dst.FuncDecl{
+		Name: dst.NewIdent(newFuncName),
+		Type: &dst.FuncType{Func: true, Params: &dst.FieldList{}, Results: &dst.FieldList{}},
+		Body: &dst.BlockStmt{List: append([]dst.Stmt{}, stmts...)},
+	}
+	newFd.Decs.Before = dst.EmptyLine
+	call := &dst.CallExpr{Fun: dst.NewIdent(newFuncName)}
+	for _, v := range params {
+		newFd.Type.Params.List = append(newFd.Type.Params.List, &dst.Field{
+			Names: []*dst.Ident{dst.NewIdent(v.Name())},
+			Type:  typeExpr(v.Type(), pkg.Types),
+		})
+		call.Args = append(call.Args, dst.NewIdent(v.Name()))
+	}
+
+	var callStmt dst.Stmt = &dst.ExprStmt{X: call}
+	if len(results) > 0 {
+		ret := &dst.ReturnStmt{}
+		as := &dst.AssignStmt{Tok: token.ASSIGN, Rhs: []dst.Expr{call}}
+		if define {
+			as.Tok = token.DEFINE
+		}
+		for _, v := range results {
+			newFd.Type.Results.List = append(newFd.Type.Results.List, &dst.Field{Type: typeExpr(v.Type(), pkg.Types)})
+			ret.Results = append(ret.Results, dst.NewIdent(v.Name()))
+			as.Lhs = append(as.Lhs, dst.NewIdent(v.Name()))
+		}
+		newFd.Body.List = append(newFd.Body.List, ret)
+		callStmt = as
+	}
+
+	fd.Body.List = append(append(append([]dst.Stmt{}, fd.Body.List[:from]...), callStmt), fd.Body.List[to:]...)
+
+	var decls []dst.Decl
+	for _, decl := range df.Decls {
+		decls = append(decls, decl)
+		if decl == fd {
+			decls = append(decls, newFd)
+		}
+	}
+	df.Decls = decls
+	return nil
+}
+
+// ExtractStmtsFromFuncBodyBetween extracts the statements, in the body of function, from fromStmt
+// to toStmt inclusively into a new function named newFuncName, see ExtractStmtsFromFuncBody.
+func ExtractStmtsFromFuncBodyBetween(pkg *Package, df *dst.File, funcName, newFuncName string, fromStmt, toStmt dst.Stmt) error {
+	fd := findFuncDecl(df, funcName)
+	if fd == nil {
+		return fmt.Errorf("function %s not found", funcName)
+	}
+
+	from, to := -1, -1
+	for i, stmt := range fd.Body.List {
+		if from == -1 && nodesEqual(stmt, fromStmt) {
+			from = i
+		}
+		if from != -1 && nodesEqual(stmt, toStmt) {
+			to = i + 1
+			break
+		}
+	}
+	if from == -1 || to == -1 {
+		return fmt.Errorf("statements not found in function %s", funcName)
+	}
+	return ExtractStmtsFromFuncBody(pkg, df, funcName, newFuncName, from, to)
+}
+
+// ExtractLinesFromFuncBody extracts the statements, in the body of function, lying in the lines
+// [fromLine, toLine] of the source file into a new function named newFuncName, see ExtractStmtsFromFuncBody.
+func ExtractLinesFromFuncBody(pkg *Package, df *dst.File, funcName, newFuncName string, fromLine, toLine int) error {
+	fd := findFuncDecl(df, funcName)
+	if fd == nil {
+		return fmt.Errorf("function %s not found", funcName)
+	}
+
+	from, to := -1, -1
+	for i, stmt := range fd.Body.List {
+		n, ok := pkg.dec.Ast.Nodes[stmt]
+		if !ok {
+			continue
+		}
+		startLine := pkg.dec.Fset.Position(n.Pos()).Line
+		endLine := pkg.dec.Fset.Position(n.End()).Line
+		if startLine >= fromLine && endLine <= toLine {
+			if from == -1 {
+				from = i
+			}
+			to = i + 1
+		}
+	}
+	if from == -1 {
+		return fmt.Errorf("no statements found in lines [%d, %d] of function %s", fromLine, toLine, funcName)
+	}
+	return ExtractStmtsFromFuncBody(pkg, df, funcName, newFuncName, from, to)
+}
+
+func findFuncDecl(df *dst.File, funcName string) *dst.FuncDecl {
+	for _, decl := range df.Decls {
+		if fd, ok := decl.(*dst.FuncDecl); ok && fd.Name.Name == funcName && fd.Body != nil {
+			return fd
+		}
+	}
+	return nil
+}
+
+// checkExtractable checks the statements don't jump out of themselves
+func checkExtractable(stmts []dst.Stmt) (err error) {
+	var depth int
+	pre := func(c *dstutil.Cursor) bool {
+		switch nn := c.Node().(type) {
+		case *dst.FuncLit:
+			return false
+		case *dst.ReturnStmt:
+			err = fmt.Errorf("statements to extract contain return")
+		case *dst.DeferStmt:
+			err = fmt.Errorf("statements to extract contain defer")
+		case *dst.BranchStmt:
+			if nn.Label != nil || (depth == 0 && nn.Tok != token.FALLTHROUGH) {
+				err = fmt.Errorf("statements to extract contain %s", nn.Tok)
+			}
+		case *dst.ForStmt, *dst.RangeStmt, *dst.SwitchStmt, *dst.TypeSwitchStmt, *dst.SelectStmt:
+			depth++
+		}
+		return err == nil
+	}
+
+	post := func(c *dstutil.Cursor) bool {
+		switch c.Node().(type) {
+		case *dst.ForStmt, *dst.RangeStmt, *dst.SwitchStmt, *dst.TypeSwitchStmt, *dst.SelectStmt:
+			depth--
+		}
+		return true
+	}
+
+	for _, stmt := range stmts {
+		dstutil.Apply(stmt, pre, post)
+	}
+	return
+}
+
+func containsVar(vars []*types.Var, v *types.Var) bool {
+	for _, vv := range vars {
+		if vv == v {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/dave/dst"
 	"github.com/stretchr/testify/assert"
 	"go/token"
+	"strings"
 	"testing"
 )
 
@@ -546,3 +547,767 @@ func TestAddStmtToFuncBodyRelativeTo(t *testing.T) {
 		}
 	})
 }
+
+func TestExtractStmtsFromFuncBody(t *testing.T) {
+	var src = `package main
+
+import "fmt"
+
+func main() {
+	a, b := 1, 2
+	sum := a + b
+	msg := fmt.Sprint(sum)
+	b++
+	fmt.Println(msg, b)
+}
+`
+
+	t.Run("by index", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "fmt"
+
+		func main() {
+			a, b := 1, 2
+			b, msg := format(a, b)
+			fmt.Println(msg, b)
+		}
+
+		func format(a int, b int) (int, string) {
+			sum := a + b
+			msg := fmt.Sprint(sum)
+			b++
+			return b, msg
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		df := pkg.Files[0]
+		assert.Nil(t, ExtractStmtsFromFuncBody(pkg, df, "main", "format", 1, 4))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("by statements", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "fmt"
+
+		func main() {
+			a, b := 1, 2
+			sum := add(a, b)
+			msg := fmt.Sprint(sum)
+			b++
+			fmt.Println(msg, b)
+		}
+
+		func add(a int, b int) int {
+			sum := a + b
+			return sum
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		df := pkg.Files[0]
+		stmt := &dst.AssignStmt{
+			Lhs: []dst.Expr{dst.NewIdent("sum")},
+			Tok: token.DEFINE,
+			Rhs: []dst.Expr{&dst.BinaryExpr{X: dst.NewIdent("a"), Op: token.ADD, Y: dst.NewIdent("b")}},
+		}
+		assert.Nil(t, ExtractStmtsFromFuncBodyBetween(pkg, df, "main", "add", stmt, stmt))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("by lines", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "fmt"
+
+		func main() {
+			a, b := 1, 2
+			sum := a + b
+			msg := fmt.Sprint(sum)
+			b = incr(b)
+			fmt.Println(msg, b)
+		}
+
+		func incr(b int) int {
+			b++
+			return b
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		df := pkg.Files[0]
+		assert.Nil(t, ExtractLinesFromFuncBody(pkg, df, "main", "incr", 9, 9))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("not extractable", func(t *testing.T) {
+		var src = `
+		package main
+
+		func main() {
+			for i := 0; i < 3; i++ {
+				if i == 1 {
+					break
+				}
+			}
+			return
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		df := pkg.Files[0]
+		assert.NotNil(t, ExtractStmtsFromFuncBody(pkg, df, "main", "f", 0, 2))
+		assert.NotNil(t, ExtractStmtsFromFuncBody(pkg, df, "main", "f", 1, 3))
+		assert.NotNil(t, ExtractStmtsFromFuncBody(pkg, df, "missing", "f", 0, 1))
+		assert.Nil(t, ExtractStmtsFromFuncBody(pkg, df, "main", "f", 0, 1))
+	})
+
+	t.Run("defer", func(t *testing.T) {
+		var src = `
+		package main
+
+		import "sync"
+
+		func main() {
+			var mu sync.Mutex
+			mu.Lock()
+			defer mu.Unlock()
+			func() {
+				defer println("done")
+			}()
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		df := pkg.Files[0]
+		assert.NotNil(t, ExtractStmtsFromFuncBody(pkg, df, "main", "lock", 1, 3))
+		assert.Nil(t, ExtractStmtsFromFuncBody(pkg, df, "main", "done", 3, 4))
+	})
+}
+
+func TestReplaceStmtInFuncBody(t *testing.T) {
+	var src = `
+	package main
+
+	import "log"
+
+	func A() {
+		log.Println("a")
+		if true {
+			log.Println("a")
+		}
+	}
+
+	func B() {
+		log.Println("a")
+	}
+	`
+
+	var expected = `
+	package main
+
+	import "log"
+
+	func A() {
+		log.Print("a")
+		if true {
+			log.Print("a")
+		}
+	}
+
+	func B() {
+		log.Println("a")
+	}
+	`
+
+	call := func(name string) dst.Stmt {
+		return &dst.ExprStmt{X: &dst.CallExpr{
+			Fun:  &dst.Ident{Name: name, Path: "log"},
+			Args: []dst.Expr{&dst.BasicLit{Kind: token.STRING, Value: `"a"`}},
+		}}
+	}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, ReplaceStmtInFuncBody(df, "A", call("Println"), call("Print")))
+	assert.False(t, ReplaceStmtInFuncBody(df, "A", call("Println"), call("Print")))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestMutateStmts(t *testing.T) {
+	var src = `
+	package main
+
+	func main() {
+		a := 1
+		a++
+		switch a {
+		case 2:
+			a++
+		}
+		for i := 0; i < 3; i++ {
+			println(i)
+		}
+	}
+	`
+
+	var expected = `
+	package main
+
+	func main() {
+		a := 1
+		a += 1
+		a *= 1
+		switch a {
+		case 2:
+			a += 1
+			a *= 1
+		}
+		for i := 0; i < 3; i++ {
+		}
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	isIncDec := func(stmt dst.Stmt) bool {
+		_, ok := stmt.(*dst.IncDecStmt)
+		return ok
+	}
+	assert.True(t, MutateStmts(df, Scope{FuncName: "main"}, isIncDec, func(stmt dst.Stmt) []dst.Stmt {
+		x := stmt.(*dst.IncDecStmt).X
+		return []dst.Stmt{
+			&dst.AssignStmt{Lhs: []dst.Expr{dst.Clone(x).(dst.Expr)}, Tok: token.ADD_ASSIGN, Rhs: []dst.Expr{&dst.BasicLit{Kind: token.INT, Value: "1"}}},
+			&dst.AssignStmt{Lhs: []dst.Expr{dst.Clone(x).(dst.Expr)}, Tok: token.MUL_ASSIGN, Rhs: []dst.Expr{&dst.BasicLit{Kind: token.INT, Value: "1"}}},
+		}
+	}))
+	assert.True(t, MutateStmts(df, EmptyScope, func(stmt dst.Stmt) bool {
+		_, ok := stmt.(*dst.ExprStmt)
+		return ok
+	}, func(stmt dst.Stmt) []dst.Stmt {
+		return nil
+	}))
+	assert.False(t, MutateStmts(df, Scope{FuncName: "other"}, isIncDec, func(stmt dst.Stmt) []dst.Stmt {
+		return nil
+	}))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestWrapStmts(t *testing.T) {
+	var src = `
+	package main
+
+	import "log"
+
+	func main() {
+		a := 1
+		// log it
+		log.Println(a)
+		log.Println(a + 1) // twice
+		a++
+		for {
+			log.Println(a)
+		}
+	}
+	`
+
+	isLog := func(stmt dst.Stmt) bool {
+		es, ok := stmt.(*dst.ExprStmt)
+		if !ok {
+			return false
+		}
+		ce, ok := es.X.(*dst.CallExpr)
+		return ok && isCallToName(ce, "Println")
+	}
+
+	t.Run("if", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "log"
+
+		func main() {
+			a := 1
+			// log it
+			if debug {
+				log.Println(a)
+				log.Println(a + 1)
+			} // twice
+			a++
+			for {
+				if debug {
+					log.Println(a)
+				}
+			}
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, WrapStmts(df, Scope{FuncName: "main"}, isLog, WrapWithIf(dst.NewIdent("debug"))))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("goroutine", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "log"
+
+		func main() {
+			a := 1
+			// log it
+			log.Println(a)
+			log.Println(a + 1) // twice
+			a++
+			go func() {
+				defer func() { recover() }()
+				for {
+					log.Println(a)
+				}
+			}()
+		}
+		`
+
+		deferRecover := &dst.DeferStmt{Call: &dst.CallExpr{Fun: &dst.FuncLit{
+			Type: &dst.FuncType{Func: true, Params: &dst.FieldList{}},
+			Body: &dst.BlockStmt{List: []dst.Stmt{
+				&dst.ExprStmt{X: &dst.CallExpr{Fun: dst.NewIdent("recover")}},
+			}},
+		}}}
+		isFor := func(stmt dst.Stmt) bool {
+			_, ok := stmt.(*dst.ForStmt)
+			return ok
+		}
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, WrapStmts(df, EmptyScope, isFor, WrapWithGoroutine(deferRecover)))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("out of scope", func(t *testing.T) {
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.False(t, WrapStmts(df, Scope{FuncName: "f"}, isLog, WrapWithBlock()))
+	})
+
+	t.Run("declared names used afterwards", func(t *testing.T) {
+		var src = `
+		package main
+
+		func main() {
+			x := f()
+			var y int
+			println(x, y)
+			z := f()
+		}
+		`
+
+		var expected = `
+		package main
+
+		func main() {
+			x := f()
+			var y int
+			println(x, y)
+			{
+				z := f()
+			}
+		}
+		`
+
+		isDecl := func(stmt dst.Stmt) bool {
+			return len(declaredNames(stmt)) > 0
+		}
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, WrapStmts(df, EmptyScope, isDecl, WrapWithBlock()))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("closures with statements leaving them", func(t *testing.T) {
+		var src = `
+		package main
+
+		func main() {
+			for _, v := range vs {
+				if v {
+					break
+				}
+			}
+			for _, v := range vs {
+				if v {
+					continue
+				}
+				println(v)
+			}
+			if ok {
+				return
+			}
+			if ok {
+				defer done()
+			}
+		}
+		`
+
+		var expected = `
+		package main
+
+		func main() {
+			for _, v := range vs {
+				if v {
+					break
+				}
+			}
+			for _, v := range vs {
+				if v {
+					continue
+				}
+				println(v)
+			}
+			if ok {
+				return
+			}
+			if ok {
+				defer done()
+			}
+		}
+		`
+
+		isIf := func(stmt dst.Stmt) bool {
+			_, ok := stmt.(*dst.IfStmt)
+			return ok
+		}
+		isRange := func(stmt dst.Stmt) bool {
+			_, ok := stmt.(*dst.RangeStmt)
+			return ok
+		}
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.False(t, WrapStmts(df, EmptyScope, isIf, WrapWithClosure()))
+		assert.False(t, WrapStmts(df, EmptyScope, isIf, WrapWithGoroutine()))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+
+		assert.True(t, WrapStmts(df, EmptyScope, isRange, WrapWithGoroutine()))
+		assert.Contains(t, printToBuf(df).String(), "go func() {\n\t\tfor _, v := range vs {")
+	})
+}
+
+func TestEnsureStmtInFuncBody(t *testing.T) {
+	var src = `
+	package main
+
+	func main() {
+		println(1)
+	}
+	`
+
+	var expected = `
+	package main
+
+	func main() {
+		println(0)
+		println(1)
+	}
+	`
+
+	stmt := &dst.ExprStmt{X: &dst.CallExpr{
+		Fun:  dst.NewIdent("println"),
+		Args: []dst.Expr{&dst.BasicLit{Kind: token.INT, Value: "0"}},
+	}}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, EnsureStmtInFuncBody(df, "main", stmt, 0))
+	assert.False(t, EnsureStmtInFuncBody(df, "main", stmt, 0))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestAddStmtsToFuncBody(t *testing.T) {
+	var src = `
+	package main
+
+	func main() {
+		println(1)
+	}
+	`
+
+	var expected = `
+	package main
+
+	import (
+		"log"
+		"time"
+	)
+
+	func main() {
+		// measure time
+		start := time.Now()
+		defer log.Println(time.Since(start)) // printed on return
+
+		println(1)
+	}
+	`
+
+	stmts, err := ParseStmts(`
+	start := time.Now()
+	defer lg.Println(time.Since(start)) // printed on return
+	`, "time", "lg log")
+	assert.Nil(t, err)
+	stmts = DecorateStmts(stmts, StmtsDecs{Comments: []string{"// measure time"}, EmptyLineAfter: true})
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, AddStmtsToFuncBody(df, "main", stmts, 0))
+	assert.False(t, AddStmtsToFuncBody(df, "f", stmts, 0))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+
+	_, err = ParseStmts("if {")
+	assert.NotNil(t, err)
+}
+
+func TestAddStmtToFuncBodyBeforeAndAfter(t *testing.T) {
+	var src = `
+	package main
+
+	func (a A) Close() {
+		a.flush()
+	}
+
+	func (b B) Close() {
+		b.flush()
+	}
+	`
+
+	var expected = `
+	package main
+
+	func (a A) Close() {
+		lock()
+		a.flush()
+	}
+
+	func (b B) Close() {
+		b.flush()
+		unlock()
+	}
+	`
+
+	stmt := func(src string) dst.Stmt {
+		stmts, err := ParseStmts(src)
+		assert.Nil(t, err)
+		return stmts[0]
+	}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, AddStmtToFuncBodyBefore(df, "Close", stmt("lock()"), stmt("a.flush()")))
+	assert.True(t, AddStmtToFuncBodyAfter(df, "Close", stmt("unlock()"), stmt("b.flush()")))
+	assert.False(t, AddStmtToFuncBodyAfter(df, "Close", stmt("unlock()"), stmt("c.flush()")))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestAddStmtsToFuncBodyAnchor(t *testing.T) {
+	var src = `
+	package main
+
+	func main() {
+		v, err := f(ctx)
+		if err != nil {
+			return
+		}
+		err = g(ctx, v)
+		go func() {
+			return
+		}()
+		switch v {
+		case 1:
+			return
+		}
+		h()
+	}
+	`
+
+	mark, err := ParseStmts("mark()")
+	assert.Nil(t, err)
+
+	cases := []struct {
+		name     string
+		anchor   Anchor
+		after    bool
+		expected string
+	}{
+		{"after first assignment", AssignAnchor("err", FirstOccurrence), true, `
+		v, err := f(ctx)
+		mark()
+		if err != nil {
+			return
+		}
+		err = g(ctx, v)`},
+		{"after last assignment", AssignAnchor("err", LastOccurrence), true, `
+		if err != nil {
+			return
+		}
+		err = g(ctx, v)
+		mark()
+		go func() {`},
+		{"before every return", ReturnAnchor(AllOccurrences), false, `
+		if err != nil {
+			mark()
+			return
+		}
+		err = g(ctx, v)
+		go func() {
+			return
+		}()
+		switch v {
+		case 1:
+			mark()
+			return
+		}`},
+		{"after last use", UsesIdentAnchor("ctx", LastOccurrence), true, `
+		err = g(ctx, v)
+		mark()
+		go func() {`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			df, _ := ParseSrcFileFromBytes([]byte(src))
+			if c.after {
+				assert.True(t, AddStmtsToFuncBodyAfterAnchor(df, "main", mark, c.anchor))
+			} else {
+				assert.True(t, AddStmtsToFuncBodyBeforeAnchor(df, "main", mark, c.anchor))
+			}
+			assert.Contains(t, strings.Join(strings.Fields(printToBuf(df).String()), " "),
+				strings.Join(strings.Fields(c.expected), " "))
+		})
+	}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.False(t, AddStmtsToFuncBodyAfterAnchor(df, "main", mark, AssignAnchor("x", AllOccurrences)))
+}
+
+func TestAddStmtBeforeReturns(t *testing.T) {
+	var src = `
+	package main
+
+	func f() (int, error) {
+		if ok {
+			return 0, nil
+		}
+		go func() {
+			return
+		}()
+		return g()
+	}
+
+	func h() (n int, err error) {
+		n, err = g()
+		if err != nil {
+			return
+		}
+		return g()
+	}
+
+	func k() (int64, error) {
+		return compute(), nil
+	}
+
+	func l() (n int, err error) {
+		if err := check(); err != nil {
+			return g1(), err
+		}
+		return g1(), nil
+	}
+
+	func main() {
+		for _, v := range vs {
+			if v {
+				return
+			}
+		}
+	}
+	`
+
+	var expected = `
+	package main
+
+	func f() (int, error) {
+		if ok {
+			done()
+			return 0, nil
+		}
+		go func() {
+			return
+		}()
+		var (
+			ret0 int
+			ret1 error
+		)
+		ret0, ret1 = g()
+		done()
+		return ret0, ret1
+	}
+
+	func h() (n int, err error) {
+		n, err = g()
+		if err != nil {
+			done()
+			return
+		}
+		n, err = g()
+		done()
+		return
+	}
+
+	func k() (int64, error) {
+		var (
+			ret0 int64
+			ret1 error
+		)
+		ret0, ret1 = compute(), nil
+		done()
+		return ret0, ret1
+	}
+
+	func l() (n int, err error) {
+		if err := check(); err != nil {
+			var (
+				ret0 int
+				ret1 error
+			)
+			ret0, ret1 = g1(), err
+			done()
+			return ret0, ret1
+		}
+		n, err = g1(), nil
+		done()
+		return
+	}
+
+	func main() {
+		for _, v := range vs {
+			if v {
+				done()
+				return
+			}
+		}
+		done()
+	}
+	`
+
+	stmts, _ := ParseStmts("done()")
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, AddStmtBeforeReturns(df, EmptyScope, stmts[0], true))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+
+	df, _ = ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, AddStmtBeforeReturns(df, Scope{FuncName: "f"}, stmts[0], false))
+	assert.Contains(t, printToBuf(df).String(), "done()\n\treturn g()")
+	assert.NotContains(t, printToBuf(df).String(), "done()\n\t\treturn\n")
+}
@@ -3,10 +3,134 @@ package gorefactor
 import (
 	"github.com/dave/dst"
 	"github.com/dave/dst/dstutil"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
 )
 
 // HasArgInCallExpr checks if the arguments of the function call has given arg
 func HasArgInCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr) (ret bool) {
+	applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		for _, cArg := range ce.Args {
+			if nodesEqual(arg, cArg) {
+				ret = true
+			}
+		}
+		return false
+	})
+	return
+}
+
+// DeleteArgFromCallExpr deletes any arg, in the function call's argument list,
+// that is semantically equal to the given arg.
+func DeleteArgFromCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		return setArgs(ce, func(args []dst.Expr) []dst.Expr {
+			var newArgs []dst.Expr
+			for _, cArg := range args {
+				if !nodesEqual(arg, cArg) {
+					newArgs = append(newArgs, cArg)
+				}
+			}
+			return newArgs
+		})
+	})
+}
+
+// AddArgToCallExpr adds given arg, to the function call's argument list, in the given position
+func AddArgToCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr, pos int) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		args := ce.Args
+		p := normalizePos(pos, len(args))
+		ce.Args = append(
+			args[:p],
+			append([]dst.Expr{dst.Clone(arg).(dst.Expr)}, args[p:]...)...)
+		return true
+	})
+}
+
+// SetArgInCallExpr sets the arg of the given index, in the function call's argument list, to expr.
+// Calls with fewer args are left untouched.
+func SetArgInCallExpr(df *dst.File, scope Scope, funcName string, index int, expr dst.Expr) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		if index < 0 || index >= len(ce.Args) || nodesEqual(ce.Args[index], expr) {
+			return false
+		}
+		ce.Args[index] = dst.Clone(expr).(dst.Expr)
+		return true
+	})
+}
+
+// ReorderArgsInCallExpr reorders the function call's argument list by the permutation, the arg of index
+// perm[i] is moved to index i, e.g. [1, 0] swaps the first two args. Calls whose number of args differs
+// from the permutation are left untouched, so are the ones whose spread arg `args...` would be moved.
+func ReorderArgsInCallExpr(df *dst.File, scope Scope, funcName string, perm []int) (modified bool) {
+	seen := make(map[int]bool)
+	for _, i := range perm {
+		if i < 0 || i >= len(perm) || seen[i] {
+			return
+		}
+		seen[i] = true
+	}
+
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		if len(ce.Args) != len(perm) || (ce.Ellipsis && perm[len(perm)-1] != len(perm)-1) {
+			return false
+		}
+		return setArgs(ce, func(args []dst.Expr) []dst.Expr {
+			newArgs := make([]dst.Expr, len(args))
+			for i, j := range perm {
+				newArgs[i] = args[j]
+			}
+			return newArgs
+		})
+	})
+}
+
+// MapArgsInCallExpr replaces the function call's argument list with the one returned by fn, which gets
+// the existing args. A spread arg `args...` stays spread only if it's still the last one.
+func MapArgsInCallExpr(df *dst.File, scope Scope, funcName string, fn func(args []dst.Expr) []dst.Expr) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		return setArgs(ce, fn)
+	})
+}
+
+// setArgs sets the args of the call to the ones returned by fn, and reports whether they're changed
+func setArgs(ce *dst.CallExpr, fn func(args []dst.Expr) []dst.Expr) bool {
+	newArgs := fn(append([]dst.Expr{}, ce.Args...))
+	changed := len(newArgs) != len(ce.Args)
+	for i := 0; !changed && i < len(newArgs); i++ {
+		changed = newArgs[i] != ce.Args[i]
+	}
+	if !changed {
+		return false
+	}
+
+	// the spread `args...` is kept only if the last arg stays the same
+	if ce.Ellipsis && (len(newArgs) == 0 || newArgs[len(newArgs)-1] != ce.Args[len(ce.Args)-1]) {
+		ce.Ellipsis = false
+	}
+	ce.Args = newArgs
+	return true
+}
+
+// applyToCallExprs calls fn on every call of the function in scope, fn reports whether the call is modified
+func applyToCallExprs(df *dst.File, scope Scope, funcName string, fn func(ce *dst.CallExpr) bool) (modified bool) {
+	return applyToCalls(df, scope, func(ce *dst.CallExpr) bool {
+		return isCallToName(ce, funcName)
+	}, fn)
+}
+
+// applyToCalls calls fn on every call in scope satisfying match, fn reports whether the call is modified
+func applyToCalls(df *dst.File, scope Scope, match func(ce *dst.CallExpr) bool, fn func(ce *dst.CallExpr) bool) (modified bool) {
+	// matched calls are collected before any is modified, so that the nesting among them is known
+	var calls []*dst.CallExpr
+	var stack []*dst.CallExpr
+	nested := make(map[*dst.CallExpr]bool)
+	outermost := make(map[*dst.CallExpr]bool)
+
 	pre := func(c *dstutil.Cursor) bool {
 		node := c.Node()
 
@@ -16,23 +140,16 @@ func HasArgInCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr)
 				return true
 			}
 
-			var found bool
 			nn := node.(*dst.CallExpr)
-			if ie, ok := nn.Fun.(*dst.Ident); ok && ie.Name == funcName {
-				found = true
-			}
-
-			if se, ok := nn.Fun.(*dst.SelectorExpr); ok && se.Sel.Name == funcName {
-				found = true
-			}
-
-			if found {
-				for _, cArg := range nn.Args {
-					if nodesEqual(arg, cArg) {
-						ret = true
-					}
+			if match(nn) {
+				if len(stack) == 0 {
+					outermost[nn] = true
 				}
-				return false
+				for _, ce := range stack {
+					nested[ce] = true
+				}
+				calls = append(calls, nn)
+				stack = append(stack, nn)
 			}
 		default:
 			scope.TryEnterScope(node)
@@ -41,17 +158,148 @@ func HasArgInCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr)
 	}
 
 	post := func(c *dstutil.Cursor) bool {
-		scope.TryLeaveScope(c.Node())
+		node := c.Node()
+		if len(stack) > 0 && node == stack[len(stack)-1] {
+			stack = stack[:len(stack)-1]
+		}
+		scope.TryLeaveScope(node)
 		return true
 	}
 
 	dstutil.Apply(df, pre, post)
+
+	for _, ce := range calls {
+		switch scope.Traversal {
+		case TraverseOutermost:
+			if !outermost[ce] {
+				continue
+			}
+		case TraverseInnermost:
+			if nested[ce] {
+				continue
+			}
+		}
+		if fn(ce) {
+			modified = true
+		}
+	}
 	return
 }
 
-// DeleteArgFromCallExpr deletes any arg, in the function call's argument list,
-// that is semantically equal to the given arg.
-func DeleteArgFromCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr) (modified bool) {
+// HasArgAtIndexInCallExpr checks if any call of the function has given arg at the given index
+func HasArgAtIndexInCallExpr(df *dst.File, scope Scope, funcName string, index int, arg dst.Expr) bool {
+	return HasArgInCallExprIf(df, scope, funcName, func(i int, cArg dst.Expr) bool {
+		return i == index && nodesEqual(arg, cArg)
+	})
+}
+
+// HasArgInCallExprIf checks if any call of the function has an arg, given with its index, satisfying
+// the predicate. A spread arg `args...` is given as the slice.
+func HasArgInCallExprIf(df *dst.File, scope Scope, funcName string, predicate func(index int, arg dst.Expr) bool) (ret bool) {
+	applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		for i, cArg := range ce.Args {
+			ret = ret || predicate(i, cArg)
+		}
+		return false
+	})
+	return
+}
+
+// HasArgOfTypeInCallExpr checks if any call of the function, in all files of the package, has an arg of
+// the given static type, which is qualified by the package path, e.g. "context.Context"
+func HasArgOfTypeInCallExpr(pkg *Package, scope Scope, funcName, typeName string) bool {
+	for _, df := range pkg.Files {
+		if HasArgInCallExprIf(df, scope, funcName, isArgOfType(pkg, typeName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteArgAtIndexFromCallExpr deletes the arg of the given index, whatever it is, from the function
+// call's argument list
+func DeleteArgAtIndexFromCallExpr(df *dst.File, scope Scope, funcName string, index int) (modified bool) {
+	return DeleteArgFromCallExprIf(df, scope, funcName, func(i int, arg dst.Expr) bool {
+		return i == index
+	})
+}
+
+// DeleteArgFromCallExprIf deletes the args, given with their index, satisfying the predicate, from the
+// function call's argument list. A spread arg `args...` is given as the slice, the call is no longer
+// spread once it's deleted.
+func DeleteArgFromCallExprIf(df *dst.File, scope Scope, funcName string, predicate func(index int, arg dst.Expr) bool) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		return setArgs(ce, func(args []dst.Expr) []dst.Expr {
+			var newArgs []dst.Expr
+			for i, arg := range args {
+				if !predicate(i, arg) {
+					newArgs = append(newArgs, arg)
+				}
+			}
+			return newArgs
+		})
+	})
+}
+
+// DeleteArgOfTypeFromCallExpr deletes the args of the given static type, which is qualified by the package
+// path, e.g. "context.Context", from the argument list of the function calls in all files of the package
+func DeleteArgOfTypeFromCallExpr(pkg *Package, scope Scope, funcName, typeName string) (modified bool) {
+	for _, df := range pkg.Files {
+		if DeleteArgFromCallExprIf(df, scope, funcName, isArgOfType(pkg, typeName)) {
+			modified = true
+		}
+	}
+	return
+}
+
+func isArgOfType(pkg *Package, typeName string) func(index int, arg dst.Expr) bool {
+	return func(index int, arg dst.Expr) bool {
+		t := pkg.TypeOf(arg)
+		return t != nil && types.TypeString(t, nil) == typeName
+	}
+}
+
+// EnsureArgInCallExpr adds given arg, to the argument list of every call of the function that doesn't
+// have it yet, in the given position
+func EnsureArgInCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr, pos int) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		for _, cArg := range ce.Args {
+			if nodesEqual(arg, cArg) {
+				return false
+			}
+		}
+		args := ce.Args
+		p := normalizePos(pos, len(args))
+		ce.Args = append(
+			args[:p],
+			append([]dst.Expr{dst.Clone(arg).(dst.Expr)}, args[p:]...)...)
+		return true
+	})
+}
+
+// ReplaceCallee replaces the function called, fromName declared in package fromPkgPath, with toName declared
+// in package toPkgPath, e.g. io/ioutil.ReadAll with io.ReadAll. An empty package path means the package of
+// the file. If argMapper isn't nil, the args are replaced with the ones it returns. Imports of the file are
+// fixed when it's printed.
+func ReplaceCallee(df *dst.File, scope Scope, fromPkgPath, fromName, toPkgPath, toName string, argMapper func(args []dst.Expr) []dst.Expr) (modified bool) {
+	return applyToCalls(df, scope, func(ce *dst.CallExpr) bool {
+		return isCallToFunc(ce, fromPkgPath, fromName)
+	}, func(ce *dst.CallExpr) bool {
+		ident := uninstantiated(ce.Fun).(*dst.Ident)
+		ident.Name, ident.Path = toName, toPkgPath
+		if argMapper != nil {
+			setArgs(ce, argMapper)
+		}
+		return true
+	})
+}
+
+// SetMethodOnReceiver renames the method called on the given receiver. The receiver can be an imported
+// package, an identifier, a selector chain like "s.client", a call like "getClient()" or an expression
+// like "(*p)", only calls on a receiver semantically equal to it are renamed.
+func SetMethodOnReceiver(df *dst.File, scope Scope, receiver, oldMethod, newMethod string) (modified bool) {
+	recv, _ := parseExpr(receiver)
+
 	pre := func(c *dstutil.Cursor) bool {
 		node := c.Node()
 
@@ -60,28 +308,24 @@ func DeleteArgFromCallExpr(df *dst.File, scope Scope, funcName string, arg dst.E
 			if !scope.IsInScope() {
 				return true
 			}
-
-			var found bool
 			nn := node.(*dst.CallExpr)
-			if ie, ok := nn.Fun.(*dst.Ident); ok && ie.Name == funcName {
-				found = true
-			}
-
-			if se, ok := nn.Fun.(*dst.SelectorExpr); ok && se.Sel.Name == funcName {
-				found = true
-			}
 
-			if found {
-				var newArgs []dst.Expr
-				for _, cArg := range nn.Args {
-					if !nodesEqual(arg, cArg) {
-						newArgs = append(newArgs, cArg)
-					} else {
-						modified = true
-					}
+			switch fun := uninstantiated(nn.Fun); fun.(type) {
+			case *dst.Ident:
+				si := fun.(*dst.Ident)
+				if si.Path == receiver && si.Name == oldMethod {
+					si.Name = newMethod
+					modified = true
+				}
+			case *dst.SelectorExpr:
+				se := fun.(*dst.SelectorExpr)
+				if recv == nil || !nodesEqual(se.X, recv) {
+					return true
+				}
+				if se.Sel.Name == oldMethod {
+					se.Sel.Name = newMethod
+					modified = true
 				}
-				nn.Args = newArgs
-				return false
 			}
 		default:
 			scope.TryEnterScope(node)
@@ -98,97 +342,902 @@ func DeleteArgFromCallExpr(df *dst.File, scope Scope, funcName string, arg dst.E
 	return
 }
 
-// AddArgToCallExpr adds given arg, to the function call's argument list, in the given position
-func AddArgToCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr, pos int) (modified bool) {
-	pre := func(c *dstutil.Cursor) bool {
-		node := c.Node()
+// SetMethodOnReceiverType renames the method called on any receiver of the given static type, in all
+// files of the package. typeName is qualified by the package path, e.g. "net/http.Client", receivers
+// of both the type and the pointer to it are matched.
+func SetMethodOnReceiverType(pkg *Package, scope Scope, typeName, oldMethod, newMethod string) (modified bool) {
+	typeName = strings.TrimPrefix(typeName, "*")
 
-		switch node.(type) {
-		case *dst.CallExpr:
-			if !scope.IsInScope() {
-				return true
+	for _, df := range pkg.Files {
+		fileScope := scope
+		pre := func(c *dstutil.Cursor) bool {
+			node := c.Node()
+
+			switch node.(type) {
+			case *dst.CallExpr:
+				if !fileScope.IsInScope() {
+					return true
+				}
+				nn := node.(*dst.CallExpr)
+
+				se, ok := nn.Fun.(*dst.SelectorExpr)
+				if !ok || se.Sel.Name != oldMethod {
+					return true
+				}
+				t := pkg.TypeOf(se.X)
+				if t == nil || strings.TrimPrefix(types.TypeString(t, nil), "*") != typeName {
+					return true
+				}
+				se.Sel.Name = newMethod
+				modified = true
+			default:
+				fileScope.TryEnterScope(node)
 			}
+			return true
+		}
+
+		post := func(c *dstutil.Cursor) bool {
+			fileScope.TryLeaveScope(c.Node())
+			return true
+		}
+
+		dstutil.Apply(df, pre, post)
+	}
+	return
+}
+
+// AddErrCheckToCallExpr captures the error result of the calls to the function into err, and checks it
+// right after the call with `if err != nil { return ..., err }`, returning zero values of the other results
+// of the enclosing function. Only calls as a statement, or as the single value of an assignment, which
+// doesn't capture the error yet, in functions whose last result is error, are checked. err is assigned if
+// it's declared as an error in the enclosing function, or declared otherwise, as err1, err2 and so on if
+// err is declared of another type, or later in the same scope.
+func AddErrCheckToCallExpr(pkg *Package, scope Scope, funcName string) (modified bool) {
+	errType := types.Universe.Lookup("error").Type()
+	isErrorResult := func(sig *types.Signature) bool {
+		results := sig.Results()
+		return results.Len() > 0 && types.Identical(results.At(results.Len()-1).Type(), errType)
+	}
+
+	for _, df := range pkg.Files {
+		var funcs []dst.Node
+		pre := func(c *dstutil.Cursor) bool {
+			node := c.Node()
+			scope.TryEnterScope(node)
 
-			nn := node.(*dst.CallExpr)
 			var ce *dst.CallExpr
+			var assign *dst.AssignStmt
+			switch nn := node.(type) {
+			case *dst.FuncDecl, *dst.FuncLit:
+				funcs = append(funcs, nn)
+				return true
+			case *dst.ExprStmt:
+				ce, _ = nn.X.(*dst.CallExpr)
+			case *dst.AssignStmt:
+				if len(nn.Rhs) == 1 && (nn.Tok == token.DEFINE || nn.Tok == token.ASSIGN) {
+					ce, _ = nn.Rhs[0].(*dst.CallExpr)
+					assign = nn
+				}
+			}
+			if ce == nil || !scope.IsInScope() || c.Index() < 0 || len(funcs) == 0 || !isCallToName(ce, funcName) {
+				return true
+			}
 
-			if ie, ok := nn.Fun.(*dst.Ident); ok && ie.Name == funcName {
-				ce = nn
+			sig, ok := pkg.TypeOf(ce.Fun).(*types.Signature)
+			if !ok || !isErrorResult(sig) || (assign != nil && len(assign.Lhs) != sig.Results().Len()-1) {
+				return true
 			}
 
-			if se, ok := nn.Fun.(*dst.SelectorExpr); ok && se.Sel.Name == funcName {
-				ce = nn
+			var callerSig *types.Signature
+			switch fn := funcs[len(funcs)-1].(type) {
+			case *dst.FuncDecl:
+				if obj := pkg.ObjectOf(fn.Name); obj != nil {
+					callerSig, _ = obj.Type().(*types.Signature)
+				}
+			case *dst.FuncLit:
+				callerSig, _ = pkg.TypeOf(fn).(*types.Signature)
+			}
+			if callerSig == nil || !isErrorResult(callerSig) {
+				return true
 			}
 
-			if ce != nil {
-				args := ce.Args
-				pos = normalizePos(pos, len(args))
-				ce.Args = append(
-					args[:pos],
-					append([]dst.Expr{dst.Clone(arg).(dst.Expr)}, args[pos:]...)...)
-				modified = true
-				return false
+			// err is reused only if it's an error, or a fresh name like err1 is declared instead
+			errName, declared := "err", false
+			for i := 1; ; i++ {
+				obj := lookupLocal(pkg, node.(dst.Stmt), errName)
+				if obj == nil {
+					// a name declared later in the same scope can't be declared here as well
+					declared = isDeclaredBefore(c, errName)
+					if declared || !isDeclaredAfter(c, errName) {
+						break
+					}
+				} else if _, ok := obj.(*types.Var); ok && types.Identical(obj.Type(), errType) {
+					declared = true
+					break
+				}
+				errName = "err" + strconv.Itoa(i)
 			}
+			if assign == nil {
+				assign = &dst.AssignStmt{Tok: token.ASSIGN, Rhs: []dst.Expr{ce}}
+				if !declared {
+					assign.Tok = token.DEFINE
+				}
+				for i := 0; i < sig.Results().Len()-1; i++ {
+					assign.Lhs = append(assign.Lhs, dst.NewIdent("_"))
+				}
+				assign.Decs.NodeDecs = node.(*dst.ExprStmt).Decs.NodeDecs
+				c.Replace(assign)
+			} else if assign.Tok == token.ASSIGN && !declared {
+				c.InsertBefore(&dst.DeclStmt{Decl: &dst.GenDecl{
+					Tok:   token.VAR,
+					Specs: []dst.Spec{&dst.ValueSpec{Names: []*dst.Ident{dst.NewIdent(errName)}, Type: dst.NewIdent("error")}},
+				}})
+			}
+			assign.Lhs = append(assign.Lhs, dst.NewIdent(errName))
+
+			ret := &dst.ReturnStmt{}
+			results := callerSig.Results()
+			for i := 0; i < results.Len()-1; i++ {
+				ret.Results = append(ret.Results, zeroValue(results.At(i).Type(), pkg.Types))
+			}
+			ret.Results = append(ret.Results, dst.NewIdent(errName))
+			ret.Decs.Before = dst.NewLine
+			c.InsertAfter(&dst.IfStmt{
+				Cond: &dst.BinaryExpr{X: dst.NewIdent(errName), Op: token.NEQ, Y: dst.NewIdent("nil")},
+				Body: &dst.BlockStmt{List: []dst.Stmt{ret}},
+			})
+			modified = true
+			return true
+		}
+
+		post := func(c *dstutil.Cursor) bool {
+			switch c.Node().(type) {
+			case *dst.FuncDecl, *dst.FuncLit:
+				funcs = funcs[:len(funcs)-1]
+			}
+			scope.TryLeaveScope(c.Node())
+			return true
+		}
+
+		dstutil.Apply(df, pre, post)
+	}
+	return
+}
+
+// isDeclaredBefore checks if the statements before the current one, in the same statement list, declare
+// a variable of the given name, which may be added after the package is type checked
+func isDeclaredBefore(c *dstutil.Cursor, name string) bool {
+	for _, stmt := range stmtListOf(c) {
+		if stmt == c.Node() {
+			break
+		}
+		switch ss := stmt.(type) {
+		case *dst.AssignStmt:
+			if ss.Tok != token.DEFINE {
+				continue
+			}
+			for _, lhs := range ss.Lhs {
+				if isIdentNamed(lhs, name) {
+					return true
+				}
+			}
+		case *dst.DeclStmt:
+			if gd, ok := ss.Decl.(*dst.GenDecl); ok && gd.Tok == token.VAR {
+				for _, spec := range gd.Specs {
+					if specDeclares(spec, name) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isDeclaredAfter checks if the statements after the current one, in the same statement list, declare
+// the given name
+func isDeclaredAfter(c *dstutil.Cursor, name string) bool {
+	list := stmtListOf(c)
+	for i := len(list) - 1; i >= 0 && list[i] != c.Node(); i-- {
+		for _, declared := range declaredNames(list[i]) {
+			if declared == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stmtListOf returns the statement list the current node is in, or nil if it's not in one
+func stmtListOf(c *dstutil.Cursor) []dst.Stmt {
+	switch parent := c.Parent().(type) {
+	case *dst.BlockStmt:
+		return parent.List
+	case *dst.CaseClause:
+		return parent.Body
+	case *dst.CommClause:
+		return parent.Body
+	}
+	return nil
+}
+
+// lookupLocal returns the local object of the given name visible at the statement, or nil if not found
+func lookupLocal(pkg *Package, stmt dst.Stmt, name string) types.Object {
+	node, ok := pkg.dec.Ast.Nodes[stmt]
+	if !ok || pkg.Types == nil {
+		return nil
+	}
+
+	pos := node.Pos()
+	inner := pkg.Types.Scope().Innermost(pos)
+	if inner == nil {
+		return nil
+	}
+	_, obj := inner.LookupParent(name, pos)
+	if obj == nil || obj.Parent() == pkg.Types.Scope() || obj.Parent() == types.Universe {
+		return nil
+	}
+	return obj
+}
+
+// FuncCallToMethodCall converts the calls of the function into calls of the method, on the arg of index
+// recvIndex, e.g. `DoThing(client, x)` into `client.DoThing(x)`. methodName defaults to the name of the
+// function if empty. Calls with explicit type arguments, or spreading the receiver arg, are left untouched.
+func FuncCallToMethodCall(df *dst.File, scope Scope, funcName string, recvIndex int, methodName string) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		// method calls are already in method form
+		ident, ok := ce.Fun.(*dst.Ident)
+		if !ok || recvIndex < 0 || recvIndex >= len(ce.Args) {
+			return false
+		}
+		if ce.Ellipsis && recvIndex == len(ce.Args)-1 {
+			return false
+		}
+
+		name := methodName
+		if name == "" {
+			name = ident.Name
+		}
+
+		recv := ce.Args[recvIndex]
+		// methods of pointer receivers are called on addressable values directly
+		if ue, ok := recv.(*dst.UnaryExpr); ok && ue.Op == token.AND && isAddressable(ue.X) {
+			recv = ue.X
+		}
+		switch recv.(type) {
+		case *dst.Ident, *dst.SelectorExpr, *dst.CallExpr, *dst.IndexExpr, *dst.ParenExpr, *dst.CompositeLit:
 		default:
-			scope.TryEnterScope(node)
+			recv = &dst.ParenExpr{X: recv}
 		}
+
+		ce.Fun = &dst.SelectorExpr{X: recv, Sel: dst.NewIdent(name)}
+		ce.Args = append(ce.Args[:recvIndex:recvIndex], ce.Args[recvIndex+1:]...)
 		return true
+	})
+}
+
+// MethodCallToFuncCall converts the calls of the method on any receiver of the given static type, in all
+// files of the package, into calls of the function declared in the package, with the receiver as the arg
+// of index recvIndex, e.g. `client.DoThing(x)` into `DoThing(client, x)`. typeName is qualified by the
+// package path, e.g. "example.com/api.Client", receivers of both the type and the pointer to it are matched.
+// The receiver is passed the way the method is declared with, e.g. `DoThing(&client, x)` for a method of
+// pointer receiver called on a value.
+func MethodCallToFuncCall(pkg *Package, scope Scope, typeName, methodName, funcName string, recvIndex int) (modified bool) {
+	typeName = strings.TrimPrefix(typeName, "*")
+
+	for _, df := range pkg.Files {
+		match := func(ce *dst.CallExpr) bool {
+			se, ok := ce.Fun.(*dst.SelectorExpr)
+			if !ok || se.Sel.Name != methodName {
+				return false
+			}
+			t := pkg.TypeOf(se.X)
+			return t != nil && strings.TrimPrefix(types.TypeString(t, nil), "*") == typeName
+		}
+
+		if applyToCalls(df, scope, match, func(ce *dst.CallExpr) bool {
+			se := ce.Fun.(*dst.SelectorExpr)
+			_, isPointer := pkg.TypeOf(se.X).(*types.Pointer)
+			var pointerRecv bool
+			if method, ok := pkg.ObjectOf(se.Sel).(*types.Func); ok {
+				_, pointerRecv = method.Type().(*types.Signature).Recv().Type().(*types.Pointer)
+			}
+
+			recv := se.X
+			for {
+				pe, ok := recv.(*dst.ParenExpr)
+				if !ok {
+					break
+				}
+				recv = pe.X
+			}
+
+			// the arg is passed as the receiver the method is declared with
+			switch {
+			case pointerRecv && !isPointer:
+				if st, ok := recv.(*dst.StarExpr); ok {
+					recv = st.X
+				} else {
+					recv = &dst.UnaryExpr{Op: token.AND, X: recv}
+				}
+			case !pointerRecv && isPointer:
+				if ue, ok := recv.(*dst.UnaryExpr); ok && ue.Op == token.AND {
+					recv = ue.X
+				} else {
+					recv = &dst.StarExpr{X: recv}
+				}
+			}
+
+			pos := normalizePos(recvIndex, len(ce.Args))
+			ce.Fun = dst.NewIdent(funcName)
+			ce.Args = append(ce.Args[:pos:pos], append([]dst.Expr{recv}, ce.Args[pos:]...)...)
+			return true
+		}) {
+			modified = true
+		}
 	}
+	return
+}
 
-	post := func(c *dstutil.Cursor) bool {
-		scope.TryLeaveScope(c.Node())
+// isAddressable checks if the expression is syntactically addressable, e.g. a variable or a field of it
+func isAddressable(expr dst.Expr) bool {
+	switch e := expr.(type) {
+	case *dst.Ident:
+		return true
+	case *dst.SelectorExpr:
+		return isAddressable(e.X)
+	case *dst.IndexExpr:
+		return isAddressable(e.X)
+	case *dst.ParenExpr:
+		return isAddressable(e.X)
+	case *dst.StarExpr:
 		return true
 	}
-
-	dstutil.Apply(df, pre, post)
-	return
+	return false
 }
 
-func SetMethodOnReceiver(df *dst.File, scope Scope, receiver, oldMethod, newMethod string) (modified bool) {
-	pre := func(c *dstutil.Cursor) bool {
-		node := c.Node()
+// InlineCallExpr replaces the calls, in pkgs, of the function declared in package pkg with its body, the
+// args are substituted for the params. Only functions whose body is a single return statement of one
+// result, or has no results at all, are inlined. Calls whose args can't be safely substituted, e.g. an arg
+// having side effects used more than once, or where the body refers to names that are unexported or
+// shadowed at the call site, are kept untouched. If deleteDecl is true, the declaration is deleted when
+// not referenced anywhere in pkgs any more.
+func InlineCallExpr(pkgs []*Package, pkg *Package, scope Scope, funcName string, deleteDecl bool) (modified bool) {
+	var fd *dst.FuncDecl
+	var declFile *dst.File
+	for _, df := range pkg.Files {
+		for _, decl := range df.Decls {
+			if dd, ok := decl.(*dst.FuncDecl); ok && dd.Recv == nil && dd.Name.Name == funcName && dd.Body != nil {
+				fd, declFile = dd, df
+			}
+		}
+	}
+	if fd == nil || fd.Type.TypeParams != nil {
+		return
+	}
+	fn, ok := pkg.ObjectOf(fd.Name).(*types.Func)
+	if !ok {
+		return
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Variadic() {
+		return
+	}
 
-		switch node.(type) {
-		case *dst.CallExpr:
-			if !scope.IsInScope() {
+	var retExpr dst.Expr
+	if sig.Results().Len() > 0 {
+		if sig.Results().Len() != 1 || len(fd.Body.List) != 1 {
+			return
+		}
+		rs, ok := fd.Body.List[0].(*dst.ReturnStmt)
+		if !ok || len(rs.Results) != 1 {
+			return
+		}
+		retExpr = rs.Results[0]
+	} else if hasReturnStmt(fd.Body) {
+		return
+	}
+
+	paramIndex := func(obj types.Object) int {
+		for i := 0; i < sig.Params().Len(); i++ {
+			if sig.Params().At(i) == obj {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// params are resolved by objects, so that names shadowing them in the body, and keys of struct
+	// literals, are left untouched. names declared in the body would capture the ones in args, and
+	// package level names referred in the body need to be visible at the call site.
+	params := make(map[*dst.Ident]int)
+	free := make(map[*dst.Ident]types.Object)
+	locals := make(map[string]bool)
+	structKeys := make(map[*dst.Ident]bool)
+	var recursive bool
+	dst.Inspect(fd.Body, func(n dst.Node) bool {
+		if cl, ok := n.(*dst.CompositeLit); ok {
+			if t := pkg.TypeOf(cl); t != nil {
+				if ptr, ok := t.Underlying().(*types.Pointer); ok {
+					t = ptr.Elem()
+				}
+				if _, ok := t.Underlying().(*types.Struct); ok {
+					for _, elt := range cl.Elts {
+						if kv, ok := elt.(*dst.KeyValueExpr); ok {
+							if key, ok := kv.Key.(*dst.Ident); ok {
+								structKeys[key] = true
+							}
+						}
+					}
+				}
+			}
+		}
+
+		ident, ok := n.(*dst.Ident)
+		if !ok || structKeys[ident] {
+			return true
+		}
+		obj := pkg.ObjectOf(ident)
+		switch {
+		case obj == nil:
+		case obj == fn:
+			recursive = true
+		case paramIndex(obj) >= 0:
+			params[ident] = paramIndex(obj)
+		case ident.Path != "":
+		case obj.Parent() == pkg.Types.Scope() || obj.Parent() == types.Universe:
+			free[ident] = obj
+		case obj.Parent() != nil:
+			locals[ident.Name] = true
+		}
+		return true
+	})
+	if recursive {
+		return
+	}
+	// a param assigned or addressed in the body is a variable of its own, substituting it would
+	// modify the arg instead
+	for _, ident := range mutatedIdents(pkg, fd.Body) {
+		if _, ok := params[ident]; ok {
+			return
+		}
+	}
+
+	// substitute clones the given node of the body, replacing params with args, for the call in package p,
+	// returns nil if it's unsafe to
+	substitute := func(p *Package, call *dst.CallExpr, node dst.Node) dst.Node {
+		args := call.Args
+		if len(args) != sig.Params().Len() {
+			return nil
+		}
+		for _, arg := range args {
+			if refersToNames(arg, locals) {
+				return nil
+			}
+		}
+
+		var inner *types.Scope
+		var pos token.Pos
+		if an, ok := p.dec.Ast.Nodes[call]; ok && p.Types != nil {
+			pos = an.Pos()
+			inner = p.Types.Scope().Innermost(pos)
+		}
+
+		cloned := dst.Clone(node)
+		var origIdents, clonedIdents []*dst.Ident
+		dst.Inspect(node, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok {
+				origIdents = append(origIdents, ident)
+			}
+			return true
+		})
+		dst.Inspect(cloned, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok {
+				clonedIdents = append(clonedIdents, ident)
+			}
+			return true
+		})
+
+		replaced := make(map[*dst.Ident]int)
+		for i, ident := range origIdents {
+			if index, ok := params[ident]; ok {
+				replaced[clonedIdents[i]] = index
+				continue
+			}
+			obj, ok := free[ident]
+			if !ok {
+				continue
+			}
+			if p != pkg && obj.Parent() == pkg.Types.Scope() {
+				if !obj.Exported() {
+					return nil
+				}
+				clonedIdents[i].Path = pkg.PkgPath
+				continue
+			}
+			if inner == nil {
+				return nil
+			}
+			if _, found := inner.LookupParent(ident.Name, pos); found != obj {
+				return nil
+			}
+		}
+
+		uses := make([]int, len(args))
+		dstutil.Apply(cloned, nil, func(c *dstutil.Cursor) bool {
+			ident, ok := c.Node().(*dst.Ident)
+			if !ok {
 				return true
 			}
-			nn := node.(*dst.CallExpr)
+			if i, ok := replaced[ident]; ok {
+				uses[i]++
+				arg := dst.Clone(args[i]).(dst.Expr)
+				if _, ok := arg.(*dst.BinaryExpr); ok {
+					arg = &dst.ParenExpr{X: arg}
+				}
+				c.Replace(arg)
+			}
+			return true
+		})
 
-			switch nn.Fun.(type) {
-			case *dst.Ident:
-				si := nn.Fun.(*dst.Ident)
-				if si.Path == receiver && si.Name == oldMethod {
-					si.Name = newMethod
-					modified = true
+		for i, arg := range args {
+			if uses[i] != 1 && !isPureExpr(arg) {
+				return nil
+			}
+		}
+		return cloned
+	}
+
+	isInlined := func(p *Package, ce *dst.CallExpr) bool {
+		_, ok := ce.Fun.(*dst.Ident)
+		return ok && calledFunc(p, ce) == fn
+	}
+
+	for _, p := range pkgs {
+		for _, df := range p.Files {
+			var inside bool
+			pre := func(c *dstutil.Cursor) bool {
+				if c.Node() == fd {
+					inside = true
+				}
+				scope.TryEnterScope(c.Node())
+				return true
+			}
+
+			// calls are inlined in post, so that the ones nested in args are inlined before
+			post := func(c *dstutil.Cursor) bool {
+				node := c.Node()
+				defer scope.TryLeaveScope(node)
+				if node == fd {
+					inside = false
+				}
+				if inside || !scope.IsInScope() {
+					return true
 				}
-			case *dst.SelectorExpr:
-				se := nn.Fun.(*dst.SelectorExpr)
 
-				// TODO: deal with other se.X type
-				switch se.X.(type) {
-				case *dst.Ident:
-					xi := se.X.(*dst.Ident)
-					if xi.Name != receiver {
+				switch nn := node.(type) {
+				case *dst.ExprStmt:
+					ce, ok := nn.X.(*dst.CallExpr)
+					if !ok || retExpr != nil || !isInlined(p, ce) || c.Index() < 0 {
 						return true
 					}
-				}
-				if se.Sel.Name == oldMethod {
-					se.Sel.Name = newMethod
+
+					body := substitute(p, ce, fd.Body)
+					if body == nil {
+						return true
+					}
+					block := body.(*dst.BlockStmt)
+					if declaresNames(block) {
+						block.Decs = dst.BlockStmtDecorations{}
+						c.InsertBefore(block)
+					} else {
+						for _, stmt := range block.List {
+							c.InsertBefore(stmt)
+						}
+					}
+					c.Delete()
+					modified = true
+				case *dst.CallExpr:
+					if retExpr == nil || !isInlined(p, nn) {
+						return true
+					}
+					if _, ok := c.Parent().(*dst.ExprStmt); ok {
+						return true
+					}
+
+					expr := substitute(p, nn, retExpr)
+					if expr == nil {
+						return true
+					}
+					if _, ok := expr.(*dst.BinaryExpr); ok {
+						switch c.Parent().(type) {
+						case *dst.BinaryExpr, *dst.UnaryExpr, *dst.SelectorExpr, *dst.StarExpr, *dst.IndexExpr, *dst.CallExpr:
+							if c.Name() != "Args" {
+								expr = &dst.ParenExpr{X: expr.(dst.Expr)}
+							}
+						}
+					}
+					c.Replace(expr)
 					modified = true
 				}
+				return true
+			}
+
+			dstutil.Apply(df, pre, post)
+		}
+	}
+
+	if deleteDecl && !isReferencedIn(pkgs, fn, fd) {
+		removeDecl(declFile, fd)
+		modified = true
+	}
+	return
+}
+
+// mutatedIdents returns the variables, referred by idents, which are assigned, incremented, addressed
+// or called pointer methods on in the node
+func mutatedIdents(p *Package, node dst.Node) (idents []*dst.Ident) {
+	add := func(expr dst.Expr) {
+		if ident := variableOf(p, expr); ident != nil {
+			idents = append(idents, ident)
+		}
+	}
+	dst.Inspect(node, func(n dst.Node) bool {
+		switch nn := n.(type) {
+		case *dst.AssignStmt:
+			for _, lhs := range nn.Lhs {
+				add(lhs)
+			}
+		case *dst.IncDecStmt:
+			add(nn.X)
+		case *dst.RangeStmt:
+			if nn.Tok == token.ASSIGN {
+				add(nn.Key)
+				add(nn.Value)
+			}
+		case *dst.UnaryExpr:
+			if nn.Op == token.AND {
+				add(nn.X)
+			}
+		case *dst.SelectorExpr:
+			ase, ok := p.dec.Ast.Nodes[nn].(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := p.Info.Selections[ase]
+			if !ok || sel.Kind() != types.MethodVal {
+				return true
+			}
+			if _, ok := sel.Obj().Type().(*types.Signature).Recv().Type().(*types.Pointer); ok {
+				if _, ok := sel.Recv().Underlying().(*types.Pointer); !ok {
+					add(nn.X)
+				}
 			}
-		default:
-			scope.TryEnterScope(node)
 		}
 		return true
+	})
+	return
+}
+
+// variableOf returns the ident of the variable whose storage the expression refers to, e.g. v for v.f
+// and v[0] of a struct or an array, or nil if it refers to no variable or through a pointer
+func variableOf(p *Package, expr dst.Expr) *dst.Ident {
+	switch e := expr.(type) {
+	case *dst.Ident:
+		return e
+	case *dst.ParenExpr:
+		return variableOf(p, e.X)
+	case *dst.SelectorExpr:
+		if t := p.TypeOf(e.X); t != nil {
+			if _, ok := t.Underlying().(*types.Struct); ok {
+				return variableOf(p, e.X)
+			}
+		}
+	case *dst.IndexExpr:
+		if t := p.TypeOf(e.X); t != nil {
+			if _, ok := t.Underlying().(*types.Array); ok {
+				return variableOf(p, e.X)
+			}
+		}
 	}
+	return nil
+}
 
-	post := func(c *dstutil.Cursor) bool {
-		scope.TryLeaveScope(c.Node())
+// refersToNames checks if the node refers to any of the local names
+func refersToNames(node dst.Node, names map[string]bool) (ret bool) {
+	dst.Inspect(node, func(n dst.Node) bool {
+		if ident, ok := n.(*dst.Ident); ok && ident.Path == "" && names[ident.Name] {
+			ret = true
+		}
+		return !ret
+	})
+	return
+}
+
+// isReferencedIn checks if the object is referenced anywhere in pkgs, except in its own declaration
+func isReferencedIn(pkgs []*Package, obj types.Object, decl dst.Node) (ret bool) {
+	for _, p := range pkgs {
+		for _, df := range p.Files {
+			dst.Inspect(df, func(n dst.Node) bool {
+				if n == decl {
+					return false
+				}
+				if ident, ok := n.(*dst.Ident); ok && p.ObjectOf(ident) == obj {
+					ret = true
+				}
+				return !ret
+			})
+			if ret {
+				return
+			}
+		}
+	}
+	return
+}
+
+// isCallToName checks if the function called is named funcName, either as an identifier or as the
+// selector of a selector expression, with or without explicit type arguments. funcName can be qualified
+// by the import path, e.g. "github.com/x/log.Printf", to match only the function of that package, no
+// matter how it's imported, while functions of the package itself are matched by bare names.
+func isCallToName(ce *dst.CallExpr, funcName string) bool {
+	if i := strings.LastIndex(funcName, "."); i >= 0 {
+		return isCallToFunc(ce, funcName[:i], funcName[i+1:])
+	}
+
+	switch fun := uninstantiated(ce.Fun).(type) {
+	case *dst.Ident:
+		return fun.Name == funcName
+	case *dst.SelectorExpr:
+		return fun.Sel.Name == funcName
+	}
+	return false
+}
+
+// isCallToFunc checks if the function called is the one of the given name declared in package pkgPath,
+// the package of the file if empty
+func isCallToFunc(ce *dst.CallExpr, pkgPath, name string) bool {
+	ident, ok := uninstantiated(ce.Fun).(*dst.Ident)
+	return ok && ident.Path == pkgPath && ident.Name == name
+}
+
+// uninstantiated strips the explicit type arguments of a generic function, e.g. Map[int, string]
+func uninstantiated(fun dst.Expr) dst.Expr {
+	switch f := fun.(type) {
+	case *dst.IndexExpr:
+		return f.X
+	case *dst.IndexListExpr:
+		return f.X
+	}
+	return fun
+}
+
+// typeArgs returns the explicit type arguments of a generic function call
+func typeArgs(ce *dst.CallExpr) []dst.Expr {
+	switch f := ce.Fun.(type) {
+	case *dst.IndexExpr:
+		return []dst.Expr{f.Index}
+	case *dst.IndexListExpr:
+		return f.Indices
+	}
+	return nil
+}
+
+// setTypeArgs sets the explicit type arguments of a generic function call
+func setTypeArgs(ce *dst.CallExpr, args []dst.Expr) {
+	fun := uninstantiated(ce.Fun)
+	switch len(args) {
+	case 0:
+		ce.Fun = fun
+	case 1:
+		ce.Fun = &dst.IndexExpr{X: fun, Index: args[0]}
+	default:
+		ce.Fun = &dst.IndexListExpr{X: fun, Indices: args}
+	}
+}
+
+// AddTypeArgToCallExpr adds given type arg, to the explicit type arguments of the generic function call,
+// in the given position. Calls without explicit type arguments are left untouched.
+func AddTypeArgToCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr, pos int) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		args := typeArgs(ce)
+		if len(args) == 0 {
+			return false
+		}
+		p := normalizePos(pos, len(args))
+		setTypeArgs(ce, append(
+			args[:p:p],
+			append([]dst.Expr{dst.Clone(arg).(dst.Expr)}, args[p:]...)...))
 		return true
+	})
+}
+
+// DeleteTypeArgFromCallExpr deletes any explicit type arg, of the generic function call, that is
+// semantically equal to the given arg
+func DeleteTypeArgFromCallExpr(df *dst.File, scope Scope, funcName string, arg dst.Expr) (modified bool) {
+	return applyToCallExprs(df, scope, funcName, func(ce *dst.CallExpr) bool {
+		var newArgs []dst.Expr
+		var deleted bool
+		for _, cArg := range typeArgs(ce) {
+			if !nodesEqual(arg, cArg) {
+				newArgs = append(newArgs, cArg)
+			} else {
+				deleted = true
+			}
+		}
+		if deleted {
+			setTypeArgs(ce, newArgs)
+		}
+		return deleted
+	})
+}
+
+// isPureExpr checks if the expression is free of side effects and cheap to evaluate more than once
+func isPureExpr(expr dst.Expr) bool {
+	switch e := expr.(type) {
+	case *dst.Ident, *dst.BasicLit:
+		return true
+	case *dst.SelectorExpr:
+		return isPureExpr(e.X)
+	case *dst.ParenExpr:
+		return isPureExpr(e.X)
+	case *dst.StarExpr:
+		return isPureExpr(e.X)
+	case *dst.UnaryExpr:
+		return e.Op != token.ARROW && isPureExpr(e.X)
 	}
+	return false
+}
 
-	dstutil.Apply(df, pre, post)
+func hasReturnStmt(node dst.Node) (ret bool) {
+	dst.Inspect(node, func(n dst.Node) bool {
+		switch n.(type) {
+		case *dst.FuncLit:
+			return false
+		case *dst.ReturnStmt:
+			ret = true
+		}
+		return !ret
+	})
+	return
+}
+
+// declaredNames returns the names the statement declares in the scope it's in
+func declaredNames(stmt dst.Stmt) (names []string) {
+	switch ss := stmt.(type) {
+	case *dst.AssignStmt:
+		if ss.Tok == token.DEFINE {
+			for _, lhs := range ss.Lhs {
+				if ident, ok := lhs.(*dst.Ident); ok && ident.Name != "_" {
+					names = append(names, ident.Name)
+				}
+			}
+		}
+	case *dst.DeclStmt:
+		if gd, ok := ss.Decl.(*dst.GenDecl); ok {
+			for _, spec := range gd.Specs {
+				switch sp := spec.(type) {
+				case *dst.ValueSpec:
+					for _, ident := range sp.Names {
+						names = append(names, ident.Name)
+					}
+				case *dst.TypeSpec:
+					names = append(names, sp.Name.Name)
+				}
+			}
+		}
+	case *dst.LabeledStmt:
+		names = append(names, ss.Label.Name)
+		names = append(names, declaredNames(ss.Stmt)...)
+	}
 	return
 }
+
+// declaresNames checks if any statement of the block declares names in the scope of the block
+func declaresNames(block *dst.BlockStmt) bool {
+	for _, stmt := range block.List {
+		if len(declaredNames(stmt)) > 0 {
+			return true
+		}
+	}
+	return false
+}
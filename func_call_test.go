@@ -741,4 +741,1123 @@ func TestSetMethodOnReceiver(t *testing.T) {
 		buf = printToBuf(df)
 		assertCodesEqual(t, expected, buf.String())
 	})
-}
\ No newline at end of file
+
+	t.Run("complex receivers", func(t *testing.T) {
+		var src = `
+		package main
+
+		func main() {
+			s.client.Get()
+			s.server.Get()
+			getClient().Get()
+			getServer().Get()
+			(*p).Get()
+			(*q).Get()
+		}
+		`
+
+		var expected = `
+		package main
+
+		func main() {
+			s.client.GetV2()
+			s.server.Get()
+			getClient().GetV2()
+			getServer().Get()
+			(*p).GetV2()
+			(*q).Get()
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		var buf *bytes.Buffer
+		assert.True(t, SetMethodOnReceiver(df, EmptyScope, "s.client", "Get", "GetV2"))
+		assert.True(t, SetMethodOnReceiver(df, EmptyScope, "getClient()", "Get", "GetV2"))
+		assert.True(t, SetMethodOnReceiver(df, EmptyScope, "(*p)", "Get", "GetV2"))
+		assert.False(t, SetMethodOnReceiver(df, EmptyScope, "s.other", "Get", "GetV2"))
+		buf = printToBuf(df)
+		assertCodesEqual(t, expected, buf.String())
+	})
+}
+
+func TestSetMethodOnReceiverType(t *testing.T) {
+	t.Run("basic", func(t *testing.T) {
+		var src = `
+		package main
+
+		type Client struct{}
+
+		func (c *Client) Get() {}
+
+		type Server struct{}
+
+		func (s Server) Get() {}
+
+		type S struct {
+			client *Client
+			server Server
+		}
+
+		func getClient() *Client { return &Client{} }
+
+		func main() {
+			var s S
+			s.client.Get()
+			s.server.Get()
+			getClient().Get()
+		}
+		`
+
+		var expected = `
+		package main
+
+		type Client struct{}
+
+		func (c *Client) Get() {}
+
+		type Server struct{}
+
+		func (s Server) Get() {}
+
+		type S struct {
+			client *Client
+			server Server
+		}
+
+		func getClient() *Client { return &Client{} }
+
+		func main() {
+			var s S
+			s.client.GetV2()
+			s.server.Get()
+			getClient().GetV2()
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		assert.True(t, SetMethodOnReceiverType(pkg, Scope{FuncName: "main"}, "example.com/main.Client", "Get", "GetV2"))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+}
+
+func TestInlineCallExpr(t *testing.T) {
+	t.Run("single return expression", func(t *testing.T) {
+		var src = `
+		package main
+
+		func add(a, b int) int {
+			return a + b
+		}
+
+		func main() {
+			x := add(1, 2)
+			y := add(x, 3) * 2
+			z := add(next(), next())
+			println(x, y, z)
+		}
+		`
+
+		var expected = `
+		package main
+
+		func main() {
+			x := 1 + 2
+			y := (x + 3) * 2
+			z := next() + next()
+			println(x, y, z)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		assert.True(t, InlineCallExpr([]*Package{pkg}, pkg, EmptyScope, "add", true))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+
+	t.Run("statements", func(t *testing.T) {
+		var src = `
+		package main
+
+		import "log"
+
+		func logf(format string, v interface{}) {
+			log.Printf(format, v)
+		}
+
+		func trace(name string) {
+			msg := "enter " + name
+			log.Println(msg)
+		}
+
+		func A() {
+			logf("%d", 1)
+			trace("A")
+		}
+
+		func B() {
+			logf("%d", 2)
+			trace(next())
+		}
+		`
+
+		var expected = `
+		package main
+
+		import "log"
+
+		func logf(format string, v interface{}) {
+			log.Printf(format, v)
+		}
+
+		func trace(name string) {
+			msg := "enter " + name
+			log.Println(msg)
+		}
+
+		func A() {
+			log.Printf("%d", 1)
+			{
+				msg := "enter " + "A"
+				log.Println(msg)
+			}
+		}
+
+		func B() {
+			logf("%d", 2)
+			trace(next())
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		pkgs, df := []*Package{pkg}, pkg.Files[0]
+		assert.True(t, InlineCallExpr(pkgs, pkg, Scope{FuncName: "A"}, "logf", true))
+		assert.True(t, InlineCallExpr(pkgs, pkg, Scope{FuncName: "A"}, "trace", true))
+		assert.Equal(t, 5, len(df.Decls), "logf is still referenced in B")
+		assert.True(t, InlineCallExpr(pkgs, pkg, EmptyScope, "trace", false))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, df))
+		assertCodesEqual(t, strings.Replace(expected, "trace(next())", `{
+				msg := "enter " + next()
+				log.Println(msg)
+			}`, 1), buf.String())
+	})
+
+	t.Run("unsafe", func(t *testing.T) {
+		var src = `
+		package main
+
+		func double(a int) int {
+			return a + a
+		}
+
+		func multi() (int, int) {
+			return 1, 2
+		}
+
+		func main() {
+			println(double(next()), double(1))
+			println(multi())
+		}
+		`
+
+		var expected = `
+		package main
+
+		func double(a int) int {
+			return a + a
+		}
+
+		func multi() (int, int) {
+			return 1, 2
+		}
+
+		func main() {
+			println(double(next()), 1 + 1)
+			println(multi())
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		pkgs := []*Package{pkg}
+		assert.True(t, InlineCallExpr(pkgs, pkg, EmptyScope, "double", true))
+		assert.False(t, InlineCallExpr(pkgs, pkg, EmptyScope, "multi", true))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+
+	t.Run("resolve params by objects", func(t *testing.T) {
+		var src = `
+		package main
+
+		type P struct{ x int }
+
+		func mk(x int) P {
+			return P{x: x}
+		}
+
+		func scale(x int) {
+			println(x)
+			for x := 0; x < 2; x++ {
+				println(x)
+			}
+		}
+
+		func shift(a int) {
+			b := 1
+			println(a + b)
+		}
+
+		func main() {
+			b := 2
+			_ = mk(1)
+			scale(b)
+			shift(b)
+		}
+		`
+
+		var expected = `
+		package main
+
+		type P struct{ x int }
+
+		func shift(a int) {
+			b := 1
+			println(a + b)
+		}
+
+		func main() {
+			b := 2
+			_ = P{x: 1}
+			println(b)
+			for x := 0; x < 2; x++ {
+				println(x)
+			}
+			shift(b)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		pkgs := []*Package{pkg}
+		assert.True(t, InlineCallExpr(pkgs, pkg, EmptyScope, "mk", true))
+		assert.True(t, InlineCallExpr(pkgs, pkg, EmptyScope, "scale", true))
+		assert.False(t, InlineCallExpr(pkgs, pkg, EmptyScope, "shift", true))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+
+	t.Run("across files and packages", func(t *testing.T) {
+		var srcA = `
+		package a
+
+		const base = 10
+
+		func Wrap(x int) int {
+			return Add(x, 1)
+		}
+
+		func Add(x, y int) int { return x + y }
+
+		func Base(x int) int {
+			return x + base
+		}
+
+		func A() int {
+			return Wrap(1)
+		}
+		`
+
+		var srcB = `
+		package a
+
+		func B() int {
+			return Wrap(2)
+		}
+		`
+
+		var srcC = `
+		package c
+
+		import "example.com/a"
+
+		func C() int {
+			return a.Wrap(3) + a.Base(4)
+		}
+		`
+
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA), "b.go": []byte(srcB)},
+			"example.com/c": {"c.go": []byte(srcC)},
+		})
+		assert.Nil(t, err)
+		a, c := pkgs[0], pkgs[1]
+
+		assert.True(t, InlineCallExpr(pkgs, a, Scope{FuncName: "A"}, "Wrap", true))
+		assert.Equal(t, 5, len(a.Files[0].Decls), "Wrap is still referenced in b.go and c.go")
+		assert.True(t, InlineCallExpr(pkgs, a, EmptyScope, "Wrap", true))
+		assert.Equal(t, 4, len(a.Files[0].Decls))
+		assert.False(t, InlineCallExpr(pkgs, a, EmptyScope, "Base", true), "Base refers to unexported base")
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, a.Fprint(buf, a.Files[1]))
+		assertCodesEqual(t, `
+		package a
+
+		func B() int {
+			return Add(2, 1)
+		}
+		`, buf.String())
+
+		buf.Reset()
+		assert.Nil(t, c.Fprint(buf, c.Files[0]))
+		assertCodesEqual(t, `
+		package c
+
+		import "example.com/a"
+
+		func C() int {
+			return a.Add(3, 1) + a.Base(4)
+		}
+		`, buf.String())
+	})
+
+	t.Run("mutated params", func(t *testing.T) {
+		var src = `
+		package main
+
+		type counter struct{ n int }
+
+		func (c *counter) inc() { c.n++ }
+
+		func bump(a int) {
+			a++
+			println(a)
+		}
+
+		func ptr(a int) *int {
+			return &a
+		}
+
+		func set(c counter) {
+			c.n = 1
+			println(c.n)
+		}
+
+		func inc(c counter) {
+			c.inc()
+		}
+
+		func show(c *counter) {
+			c.n = 2
+		}
+
+		func main() {
+			x := 1
+			bump(x)
+			p := ptr(x)
+			c := counter{}
+			set(c)
+			inc(c)
+			show(&c)
+			println(x, p)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		for _, name := range []string{"bump", "ptr", "set", "inc"} {
+			assert.False(t, InlineCallExpr([]*Package{pkg}, pkg, EmptyScope, name, true), name)
+		}
+		assert.True(t, InlineCallExpr([]*Package{pkg}, pkg, EmptyScope, "show", true))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assert.Contains(t, buf.String(), "bump(x)")
+		assert.Contains(t, buf.String(), "p := ptr(x)")
+		assert.Contains(t, buf.String(), "(&c).n = 2")
+	})
+}
+
+func TestGenericCallExpr(t *testing.T) {
+	var src = `
+	package main
+
+	import "example.com/slices"
+
+	func main() {
+		Map[int](xs, double)
+		Map(xs, double)
+		slices.Map[int, string](xs, format)
+	}
+	`
+
+	t.Run("args", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "example.com/slices"
+
+		func main() {
+			Map[int](ctx, xs, double)
+			Map(ctx, xs, double)
+			slices.Map[int, string](ctx, xs, format)
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, HasArgInCallExpr(df, EmptyScope, "Map", dst.NewIdent("format")))
+		assert.True(t, AddArgToCallExpr(df, EmptyScope, "Map", dst.NewIdent("ctx"), 0))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("type args", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "example.com/slices"
+
+		func main() {
+			Map[error](xs, double)
+			Map(xs, double)
+			slices.Map[string, error](xs, format)
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, AddTypeArgToCallExpr(df, Scope{FuncName: "main"}, "Map", dst.NewIdent("error"), -1))
+		assert.True(t, DeleteTypeArgFromCallExpr(df, EmptyScope, "Map", dst.NewIdent("int")))
+		assert.False(t, DeleteTypeArgFromCallExpr(df, EmptyScope, "Map", dst.NewIdent("int")))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+}
+
+func TestEnsureArgInCallExpr(t *testing.T) {
+	var src = `
+	package main
+
+	func f(args ...int) {}
+
+	func main() {
+		f(1)
+		f(0, 1)
+		f()
+	}
+	`
+
+	var expected = `
+	package main
+
+	func f(args ...int) {}
+
+	func main() {
+		f(0, 1)
+		f(0, 1)
+		f(0)
+	}
+	`
+
+	arg := &dst.BasicLit{Kind: token.INT, Value: "0"}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, EnsureArgInCallExpr(df, EmptyScope, "f", arg, 0))
+	assert.False(t, EnsureArgInCallExpr(df, EmptyScope, "f", arg, 0))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestAddErrCheckToCallExpr(t *testing.T) {
+	var src = `
+	package main
+
+	type Config struct{}
+
+	func load(name string) (*Config, error) { return nil, nil }
+
+	func save(c *Config) error { return nil }
+
+	func run() (Config, int, error) {
+		save(nil)
+		c, _ := load("a")
+		save(c) // save it
+		c = load("b")
+		return Config{}, 0, nil
+	}
+
+	func reload() error {
+		var c *Config
+		c = load("c")
+		save(c)
+		return nil
+	}
+
+	func main() {
+		save(nil)
+	}
+	`
+
+	var expected = `
+	package main
+
+	type Config struct{}
+
+	func load(name string) (*Config, error) { return nil, nil }
+
+	func save(c *Config) error { return nil }
+
+	func run() (Config, int, error) {
+		err := save(nil)
+		if err != nil {
+			return Config{}, 0, err
+		}
+		c, _ := load("a")
+		err = save(c) // save it
+		if err != nil {
+			return Config{}, 0, err
+		}
+		c, err = load("b")
+		if err != nil {
+			return Config{}, 0, err
+		}
+		return Config{}, 0, nil
+	}
+
+	func reload() error {
+		var c *Config
+		var err error
+		c, err = load("c")
+		if err != nil {
+			return err
+		}
+		err = save(c)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	func main() {
+		save(nil)
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+	assert.Nil(t, err)
+	assert.True(t, AddErrCheckToCallExpr(pkg, Scope{FuncName: "reload"}, "load"))
+	assert.True(t, AddErrCheckToCallExpr(pkg, EmptyScope, "save"))
+	assert.True(t, AddErrCheckToCallExpr(pkg, EmptyScope, "load"))
+	assert.False(t, AddErrCheckToCallExpr(pkg, EmptyScope, "load"))
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, expected, buf.String())
+}
+
+func TestAddErrCheckToCallExprErrOfOtherType(t *testing.T) {
+	var src = `
+	package main
+
+	func do() error { return nil }
+
+	func run() error {
+		err := "msg"
+		do()
+		do()
+		println(err)
+		return nil
+	}
+	`
+
+	var expected = `
+	package main
+
+	func do() error { return nil }
+
+	func run() error {
+		err := "msg"
+		err1 := do()
+		if err1 != nil {
+			return err1
+		}
+		err1 = do()
+		if err1 != nil {
+			return err1
+		}
+		println(err)
+		return nil
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+	assert.Nil(t, err)
+	assert.True(t, AddErrCheckToCallExpr(pkg, EmptyScope, "do"))
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, expected, buf.String())
+}
+
+func TestReplaceArgsInCallExpr(t *testing.T) {
+	var src = `
+	package main
+
+	func get(key string, ctx context.Context, opts ...int) {}
+
+	func main() {
+		get("a", ctx)
+		get("b", ctx, 1)
+		get("c", ctx, opts...)
+	}
+	`
+
+	t.Run("set", func(t *testing.T) {
+		var expected = `
+		package main
+
+		func get(key string, ctx context.Context, opts ...int) {}
+
+		func main() {
+			get("a", nil)
+			get("b", nil, 1)
+			get("c", nil, opts...)
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, SetArgInCallExpr(df, EmptyScope, "get", 1, dst.NewIdent("nil")))
+		assert.False(t, SetArgInCallExpr(df, EmptyScope, "get", 1, dst.NewIdent("nil")))
+		assert.False(t, SetArgInCallExpr(df, EmptyScope, "get", 3, dst.NewIdent("nil")))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		var expected = `
+		package main
+
+		func get(key string, ctx context.Context, opts ...int) {}
+
+		func main() {
+			get(ctx, "a")
+			get(ctx, "b", 1)
+			get(ctx, "c", opts...)
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, ReorderArgsInCallExpr(df, EmptyScope, "get", []int{1, 0}))
+		assert.True(t, ReorderArgsInCallExpr(df, EmptyScope, "get", []int{1, 0, 2}))
+		assert.False(t, ReorderArgsInCallExpr(df, EmptyScope, "get", []int{0, 0}))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+
+		df, _ = ParseSrcFileFromBytes([]byte(`package main
+
+		func main() {
+			get("c", ctx, opts...)
+		}`))
+		assert.False(t, ReorderArgsInCallExpr(df, EmptyScope, "get", []int{2, 1, 0}))
+	})
+
+	t.Run("map", func(t *testing.T) {
+		var expected = `
+		package main
+
+		func get(key string, ctx context.Context, opts ...int) {}
+
+		func main() {
+			get(ctx, "a")
+			get(ctx, "b")
+			get(ctx, "c")
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, MapArgsInCallExpr(df, EmptyScope, "get", func(args []dst.Expr) []dst.Expr {
+			return []dst.Expr{args[1], args[0]}
+		}))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+}
+
+func TestDeleteArgFromCallExprByPosition(t *testing.T) {
+	var src = `
+	package main
+
+	import "context"
+
+	func get(ctx context.Context, key string, opts ...int) {}
+
+	func main() {
+		ctx := context.Background()
+		opts := []int{1}
+		get(ctx, "a")
+		get(context.TODO(), "b", 1, 2)
+		get(ctx, "c", opts...)
+	}
+	`
+
+	t.Run("by index", func(t *testing.T) {
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, HasArgAtIndexInCallExpr(df, EmptyScope, "get", 1, &dst.BasicLit{Kind: token.STRING, Value: `"c"`}))
+		assert.False(t, HasArgAtIndexInCallExpr(df, EmptyScope, "get", 0, &dst.BasicLit{Kind: token.STRING, Value: `"c"`}))
+		assert.True(t, DeleteArgAtIndexFromCallExpr(df, EmptyScope, "get", 2))
+		assert.False(t, DeleteArgAtIndexFromCallExpr(df, EmptyScope, "get", 3))
+		assert.Contains(t, printToBuf(df).String(), `get(context.TODO(), "b", 2)`)
+		assert.Contains(t, printToBuf(df).String(), `get(ctx, "c")`)
+	})
+
+	t.Run("by predicate", func(t *testing.T) {
+		isLit := func(index int, arg dst.Expr) bool {
+			_, ok := arg.(*dst.BasicLit)
+			return ok && index > 1
+		}
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, HasArgInCallExprIf(df, EmptyScope, "get", isLit))
+		assert.True(t, DeleteArgFromCallExprIf(df, EmptyScope, "get", isLit))
+		assert.False(t, HasArgInCallExprIf(df, EmptyScope, "get", isLit))
+		assert.Contains(t, printToBuf(df).String(), `get(context.TODO(), "b")`)
+		assert.Contains(t, printToBuf(df).String(), `get(ctx, "c", opts...)`)
+	})
+
+	t.Run("by type", func(t *testing.T) {
+		var expected = `
+		package main
+
+		import "context"
+
+		func get(ctx context.Context, key string, opts ...int) {}
+
+		func main() {
+			ctx := context.Background()
+			opts := []int{1}
+			get("a")
+			get("b", 1, 2)
+			get("c", opts...)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		assert.True(t, HasArgOfTypeInCallExpr(pkg, EmptyScope, "get", "context.Context"))
+		assert.False(t, HasArgOfTypeInCallExpr(pkg, EmptyScope, "get", "float64"))
+		assert.True(t, DeleteArgOfTypeFromCallExpr(pkg, EmptyScope, "get", "context.Context"))
+		assert.False(t, DeleteArgOfTypeFromCallExpr(pkg, EmptyScope, "get", "context.Context"))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+}
+
+func TestReplaceCallee(t *testing.T) {
+	var src = `
+	package main
+
+	import (
+		"io/ioutil"
+		"os"
+
+		"github.com/x/pkga"
+	)
+
+	func main() {
+		data, _ := ioutil.ReadAll(os.Stdin)
+		c := pkga.New(data)
+		New(data)
+	}
+	`
+
+	var expected = `
+	package main
+
+	import (
+		"io"
+		"os"
+
+		"github.com/x/pkgb"
+	)
+
+	func main() {
+		data, _ := io.ReadAll(os.Stdin)
+		c := pkgb.NewWithOptions(data, pkgb.Options{})
+		New(data)
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, ReplaceCallee(df, EmptyScope, "io/ioutil", "ReadAll", "io", "ReadAll", nil))
+	assert.True(t, ReplaceCallee(df, EmptyScope, "github.com/x/pkga", "New", "github.com/x/pkgb", "NewWithOptions", func(args []dst.Expr) []dst.Expr {
+		return append(args, &dst.CompositeLit{Type: &dst.Ident{Name: "Options", Path: "github.com/x/pkgb"}})
+	}))
+	assert.False(t, ReplaceCallee(df, EmptyScope, "github.com/x/pkga", "New", "github.com/x/pkgb", "NewWithOptions", nil))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestConvertFuncCallAndMethodCall(t *testing.T) {
+	var src = `
+	package main
+
+	type Client struct{}
+
+	func (c *Client) Close() {}
+
+	func DoThing(c *Client, x int) {}
+
+	func main() {
+		var c Client
+		p := &c
+		DoThing(&c, 1)
+		DoThing(p, 2)
+		DoThing(*&p, 3)
+		p.Close()
+		(*p).Close()
+	}
+	`
+
+	t.Run("to method call", func(t *testing.T) {
+		var expected = `
+		package main
+
+		type Client struct{}
+
+		func (c *Client) Close() {}
+
+		func DoThing(c *Client, x int) {}
+
+		func main() {
+			var c Client
+			p := &c
+			c.DoThing(1)
+			p.DoThing(2)
+			(*&p).DoThing(3)
+			p.Close()
+			(*p).Close()
+		}
+		`
+
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		assert.True(t, FuncCallToMethodCall(df, EmptyScope, "DoThing", 0, ""))
+		assert.False(t, FuncCallToMethodCall(df, EmptyScope, "DoThing", 0, ""))
+		assertCodesEqual(t, expected, printToBuf(df).String())
+	})
+
+	t.Run("to func call", func(t *testing.T) {
+		var expected = `
+		package main
+
+		type Client struct{}
+
+		func (c *Client) Close() {}
+
+		func DoThing(c *Client, x int) {}
+
+		func main() {
+			var c Client
+			p := &c
+			DoThing(&c, 1)
+			DoThing(p, 2)
+			DoThing(*&p, 3)
+			CloseClient(p)
+			CloseClient(p)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		assert.True(t, MethodCallToFuncCall(pkg, EmptyScope, "example.com/main.Client", "Close", "CloseClient", 0))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+
+	t.Run("to func call of receiver kinds", func(t *testing.T) {
+		var src = `
+		package main
+
+		type T struct{ n int }
+
+		func (t *T) Inc() { t.n++ }
+
+		func (t T) Get() int { return t.n }
+
+		func main() {
+			var v T
+			p := &v
+			v.Inc()
+			_ = p.Get()
+			_ = (&v).Get()
+		}
+		`
+
+		var expected = `
+		package main
+
+		type T struct{ n int }
+
+		func (t *T) Inc() { t.n++ }
+
+		func (t T) Get() int { return t.n }
+
+		func main() {
+			var v T
+			p := &v
+			IncT(&v)
+			_ = GetT(*p)
+			_ = GetT(v)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+		assert.Nil(t, err)
+		assert.True(t, MethodCallToFuncCall(pkg, EmptyScope, "example.com/main.T", "Inc", "IncT", 0))
+		assert.True(t, MethodCallToFuncCall(pkg, EmptyScope, "example.com/main.T", "Get", "GetT", 0))
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assertCodesEqual(t, expected, buf.String())
+	})
+}
+
+func TestQualifiedCallee(t *testing.T) {
+	var src = `
+	package main
+
+	import (
+		"fmt"
+		l "log"
+		. "strings"
+	)
+
+	func Printf(format string, args ...interface{}) {}
+
+	func main() {
+		fmt.Printf("a")
+		l.Printf("b")
+		Printf("c")
+		Repeat("d", 1)
+	}
+	`
+
+	var expected = `
+	package main
+
+	import (
+		"fmt"
+		l "log"
+		. "strings"
+	)
+
+	func Printf(format string, args ...interface{}) {}
+
+	func main() {
+		fmt.Printf("a")
+		l.Printf("b", 0)
+		Printf("c")
+		Repeat("d", 2)
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+	assert.Nil(t, err)
+	df := pkg.Files[0]
+
+	zero := &dst.BasicLit{Kind: token.INT, Value: "0"}
+	assert.True(t, AddArgToCallExpr(df, EmptyScope, "log.Printf", zero, -1))
+	assert.True(t, HasArgInCallExpr(df, EmptyScope, "log.Printf", zero))
+	assert.False(t, HasArgInCallExpr(df, EmptyScope, "fmt.Printf", zero))
+	assert.True(t, SetArgInCallExpr(df, EmptyScope, "strings.Repeat", 1, &dst.BasicLit{Kind: token.INT, Value: "2"}))
+	assert.False(t, SetArgInCallExpr(df, EmptyScope, "bytes.Repeat", 1, zero))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, df))
+	assertCodesEqual(t, expected, buf.String())
+}
+
+func TestTraversalOfNestedCallExpr(t *testing.T) {
+	var src = `
+	package main
+
+	func main() {
+		f(f(f()))
+		b.With(1).With(2)
+	}
+	`
+
+	arg := dst.NewIdent("x")
+	cases := []struct {
+		traversal Traversal
+		expected  string
+	}{
+		{TraverseAll, "f(f(f(x), x), x)\nb.With(1, x).With(2, x)"},
+		{TraverseOutermost, "f(f(f()), x)\nb.With(1).With(2, x)"},
+		{TraverseInnermost, "f(f(f(x)))\nb.With(1, x).With(2)"},
+	}
+
+	for _, c := range cases {
+		df, _ := ParseSrcFileFromBytes([]byte(src))
+		scope := Scope{FuncName: "main", Traversal: c.traversal}
+		assert.True(t, AddArgToCallExpr(df, scope, "f", arg, -1))
+		assert.True(t, AddArgToCallExpr(df, scope, "With", arg, -1))
+		assert.True(t, HasArgInCallExpr(df, scope, "With", arg))
+		assertCodesEqual(t, fmt.Sprintf(`
+		package main
+
+		func main() {
+			%s
+		}
+		`, c.expected), printToBuf(df).String())
+	}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, AddArgToCallExpr(df, Scope{Traversal: TraverseInnermost}, "f", arg, 0))
+	assert.False(t, DeleteArgFromCallExpr(df, Scope{Traversal: TraverseOutermost}, "f", arg))
+	assert.True(t, DeleteArgFromCallExpr(df, Scope{Traversal: TraverseInnermost}, "f", arg))
+	assert.False(t, HasArgInCallExpr(df, EmptyScope, "f", arg))
+}
+
+func TestAddErrCheckToCallExprErrDeclaredLater(t *testing.T) {
+	var src = `
+	package main
+
+	func do() error { return nil }
+
+	func other() error { return nil }
+
+	func run() error {
+		do()
+		do()
+		err := other()
+		return err
+	}
+	`
+
+	var expected = `
+	package main
+
+	func do() error { return nil }
+
+	func other() error { return nil }
+
+	func run() error {
+		err1 := do()
+		if err1 != nil {
+			return err1
+		}
+		err1 = do()
+		if err1 != nil {
+			return err1
+		}
+		err := other()
+		return err
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/main", map[string][]byte{"main.go": []byte(src)})
+	assert.Nil(t, err)
+	assert.True(t, AddErrCheckToCallExpr(pkg, EmptyScope, "do"))
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, expected, buf.String())
+}
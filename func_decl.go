@@ -1,8 +1,12 @@
 package gorefactor
 
 import (
+	"fmt"
 	"github.com/dave/dst"
 	"github.com/dave/dst/dstutil"
+	"go/ast"
+	"go/token"
+	"go/types"
 )
 
 // HasFieldInFuncDeclParams checks if the declaration params of the function, contains the given field
@@ -30,7 +34,8 @@ func HasFieldInFuncDeclParams(df *dst.File, funcName string, field *dst.Field) (
 }
 
 // DeleteFieldFromFuncDeclParams deletes any field, in the declaration params of the function,
-// that is semantically equal to given field
+// that is semantically equal to given field. A field of a single name also deletes the param out of
+// the ones sharing its type, e.g. `b int` out of `a, b, c int`.
 func DeleteFieldFromFuncDeclParams(df *dst.File, funcName string, field *dst.Field) (modified bool) {
 	pre := func(c *dstutil.Cursor) bool {
 		node := c.Node()
@@ -38,16 +43,11 @@ func DeleteFieldFromFuncDeclParams(df *dst.File, funcName string, field *dst.Fie
 		switch node.(type) {
 		case *dst.FuncDecl:
 			if nn := node.(*dst.FuncDecl); nn.Name.Name == funcName {
-				funcType := nn.Type
-				var newList []*dst.Field
-				for _, ff := range funcType.Params.List {
-					if !nodesEqual(ff, field) {
-						newList = append(newList, ff)
-					} else {
-						modified = true
-					}
-				}
-				funcType.Params.List = newList
+				removed := deleteParams(nn.Type, func(ff *dst.Field, index int, name *dst.Ident) bool {
+					return nodesEqual(ff, field) || (name != nil && len(field.Names) == 1 &&
+						name.Name == field.Names[0].Name && nodesEqual(ff.Type, field.Type))
+				})
+				modified = modified || len(removed) > 0
 				return false
 			}
 		}
@@ -58,6 +58,41 @@ func DeleteFieldFromFuncDeclParams(df *dst.File, funcName string, field *dst.Fie
 	return
 }
 
+// deleteParams deletes the params, of the function type, for which remove returns true, given the field
+// declaring the param, the index of the param and its name, nil for an unnamed param. Fields left with
+// no names are deleted. The names of the params deleted are returned, empty for unnamed params.
+func deleteParams(ft *dst.FuncType, remove func(field *dst.Field, index int, name *dst.Ident) bool) (removed []string) {
+	var newList []*dst.Field
+	var index int
+	for _, field := range ft.Params.List {
+		if len(field.Names) == 0 {
+			if remove(field, index, nil) {
+				removed = append(removed, "")
+			} else {
+				newList = append(newList, field)
+			}
+			index++
+			continue
+		}
+
+		var names []*dst.Ident
+		for _, ident := range field.Names {
+			if remove(field, index, ident) {
+				removed = append(removed, ident.Name)
+			} else {
+				names = append(names, ident)
+			}
+			index++
+		}
+		if len(names) > 0 {
+			field.Names = names
+			newList = append(newList, field)
+		}
+	}
+	ft.Params.List = newList
+	return
+}
+
 // AddFieldToFuncDeclParams adds given field, to the declaration params of the function, in the given position
 func AddFieldToFuncDeclParams(df *dst.File, funcName string, field *dst.Field, pos int) (modified bool) {
 	pre := func(c *dstutil.Cursor) bool {
@@ -84,4 +119,514 @@ func AddFieldToFuncDeclParams(df *dst.File, funcName string, field *dst.Field, p
 	return
 }
 
+// EnsureFieldInFuncDeclParams adds given field, to the declaration params of the function, in the given
+// position, unless the params already contain it
+func EnsureFieldInFuncDeclParams(df *dst.File, funcName string, field *dst.Field, pos int) (modified bool) {
+	if HasFieldInFuncDeclParams(df, funcName, field) {
+		return
+	}
+	return AddFieldToFuncDeclParams(df, funcName, field, pos)
+}
+
+// RemoveUnusedParams removes the params, of the function declared in package pkg, not referenced in its body,
+// and deletes the args of them at every call site in pkgs. funcName is either the name of a function or
+// "T.m" for the method m of type T. Methods implementing interfaces, functions used other than called
+// directly, and calls whose args to be deleted may have side effects, are reported as errors with nothing
+// changed. The names of the params removed are returned, empty for unnamed params.
+func RemoveUnusedParams(pkgs []*Package, pkg *Package, funcName string) (removed []string, err error) {
+	var fd *dst.FuncDecl
+	for _, df := range pkg.Files {
+		for _, decl := range df.Decls {
+			dd, ok := decl.(*dst.FuncDecl)
+			if !ok || dd.Body == nil {
+				continue
+			}
+			if (dd.Recv == nil && dd.Name.Name == funcName) || (dd.Recv != nil && receiverTypeName(dd)+"."+dd.Name.Name == funcName) {
+				fd = dd
+			}
+		}
+	}
+	if fd == nil {
+		return nil, fmt.Errorf("function %s not found in package %s", funcName, pkg.PkgPath)
+	}
+	fn, ok := pkg.ObjectOf(fd.Name).(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("function %s is not type checked", funcName)
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Recv() != nil && implementsInterface(pkgs, fn) {
+		return nil, fmt.Errorf("method %s implements an interface", funcName)
+	}
+
+	used := make(map[types.Object]bool)
+	dst.Inspect(fd.Body, func(n dst.Node) bool {
+		if ident, ok := n.(*dst.Ident); ok {
+			used[pkg.ObjectOf(ident)] = true
+		}
+		return true
+	})
+
+	unused := make(map[int]bool)
+	var index int
+	for _, field := range fd.Type.Params.List {
+		if len(field.Names) == 0 {
+			unused[index] = true
+			index++
+		}
+		for _, ident := range field.Names {
+			unused[index] = ident.Name == "_" || !used[pkg.ObjectOf(ident)]
+			index++
+		}
+	}
+	last := index - 1
+	isUnusedArg := func(i int) bool {
+		return unused[i] || (sig.Variadic() && i > last && unused[last])
+	}
+
+	var calls []*dst.CallExpr
+	var refs int
+	for _, p := range pkgs {
+		for _, df := range p.Files {
+			dst.Inspect(df, func(n dst.Node) bool {
+				switch nn := n.(type) {
+				case *dst.Ident:
+					if obj, ok := p.ObjectOf(nn).(*types.Func); ok && nn != fd.Name && isSameFunc(obj, fn) {
+						refs++
+					}
+				case *dst.CallExpr:
+					if !isSameFunc(calledFunc(p, nn), fn) || isMethodExpr(p, nn.Fun) {
+						return true
+					}
+					for i, arg := range nn.Args {
+						if isUnusedArg(i) && !isSideEffectFree(arg) {
+							err = fmt.Errorf("arg of %s at index %d may have side effects", funcName, i)
+						}
+					}
+					calls = append(calls, nn)
+				}
+				return true
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if refs > len(calls) {
+		return nil, fmt.Errorf("function %s is used other than called directly", funcName)
+	}
+
+	for _, ce := range calls {
+		setArgs(ce, func(args []dst.Expr) []dst.Expr {
+			var newArgs []dst.Expr
+			for i, arg := range args {
+				if !isUnusedArg(i) {
+					newArgs = append(newArgs, arg)
+				}
+			}
+			return newArgs
+		})
+	}
+
+	removed = deleteParams(fd.Type, func(field *dst.Field, index int, name *dst.Ident) bool {
+		return unused[index]
+	})
+	return
+}
+
+// isMethodExpr checks if the function expression is a method expression, e.g. T.m
+func isMethodExpr(p *Package, fun dst.Expr) bool {
+	se, ok := fun.(*dst.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ase, ok := p.dec.Ast.Nodes[se].(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := p.Info.Selections[ase]
+	return ok && sel.Kind() == types.MethodExpr
+}
+
+// implementsInterface checks if the method is needed by the receiver type to implement any interface
+// declared in pkgs or the packages imported by them
+func implementsInterface(pkgs []*Package, method *types.Func) bool {
+	recv := method.Type().(*types.Signature).Recv().Type()
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+
+	scopes := make(map[*types.Package]bool)
+	for _, p := range pkgs {
+		scopes[p.Types] = true
+		for _, imp := range p.Types.Imports() {
+			scopes[imp] = true
+		}
+	}
+	for tp := range scopes {
+		for _, name := range tp.Scope().Names() {
+			tn, ok := tp.Scope().Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			iface, ok := tn.Type().Underlying().(*types.Interface)
+			if !ok {
+				continue
+			}
+			for i := 0; i < iface.NumMethods(); i++ {
+				if iface.Method(i).Name() != method.Name() {
+					continue
+				}
+				if types.Implements(recv, iface) || types.Implements(types.NewPointer(recv), iface) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// SetReceiverName renames the receiver of the method of the given type, together with the references to it
+// in the method body, or names the receiver if it's unnamed. Nothing happens if newName is referred in
+// the method already.
+func SetReceiverName(df *dst.File, typeName, methodName, newName string) (modified bool) {
+	fd := findMethodDecl(df, typeName, methodName)
+	if fd == nil {
+		return
+	}
+	recvField := fd.Recv.List[0]
+	recv := dst.NewIdent("_")
+	if len(recvField.Names) > 0 {
+		recv = recvField.Names[0]
+	}
+	if recv.Name == newName || (recv.Obj == nil && recv.Name != "_") {
+		return
+	}
+
+	var conflict bool
+	dst.Inspect(fd, func(n dst.Node) bool {
+		if ident, ok := n.(*dst.Ident); ok && ident.Name == newName && ident.Path == "" {
+			conflict = true
+		}
+		return !conflict
+	})
+	if conflict {
+		return
+	}
 
+	if recv.Obj != nil {
+		dst.Inspect(fd.Body, func(n dst.Node) bool {
+			if ident, ok := n.(*dst.Ident); ok && ident.Obj == recv.Obj {
+				ident.Name = newName
+			}
+			return true
+		})
+	}
+	recv.Name = newName
+	recvField.Names = []*dst.Ident{recv}
+	return true
+}
+
+// SetReceiverPointer switches the receiver of the method of the given type, declared in package pkg, to
+// a pointer receiver or a value receiver. Calls in pkgs on composite literals, like T{}.m(), are rewritten
+// to (&T{}).m() when switched to a pointer receiver, while calls like (&t).m() are simplified to t.m() when
+// switched to a value receiver. Method expressions like T.m are rewritten to (*T).m when switched to a
+// pointer receiver. Calls on values that can't be addressed, like the result of a function, and methods
+// implementing interfaces, which might not be implemented by the value type any more, are reported as
+// errors when switched to a pointer receiver, with nothing changed.
+func SetReceiverPointer(pkgs []*Package, pkg *Package, typeName, methodName string, pointer bool) error {
+	fd, method, err := findMethod(pkg, typeName, methodName)
+	if err != nil {
+		return err
+	}
+
+	recvField := fd.Recv.List[0]
+	se, isPointer := recvField.Type.(*dst.StarExpr)
+	if isPointer == pointer {
+		return nil
+	}
+	if pointer && implementsInterface(pkgs, method) {
+		return fmt.Errorf("method %s.%s implements an interface", typeName, methodName)
+	}
+
+	var fixes []func()
+	for _, p := range pkgs {
+		for _, df := range p.Files {
+			dst.Inspect(df, func(n dst.Node) bool {
+				// method expressions like T.m are only valid as (*T).m for pointer receivers, and so
+				// are their receiver args, (*T).m(&t)
+				if se, ok := n.(*dst.SelectorExpr); ok && pointer && p.ObjectOf(se.Sel) == method && isMethodExpr(p, se) {
+					if _, ok := p.TypeOf(se.X).(*types.Pointer); !ok {
+						x := se.X
+						fixes = append(fixes, func() { se.X = &dst.ParenExpr{X: &dst.StarExpr{X: x}} })
+					}
+					return true
+				}
+				ce, ok := n.(*dst.CallExpr)
+				if !ok || err != nil || calledFunc(p, ce) != method {
+					return true
+				}
+				fun, ok := ce.Fun.(*dst.SelectorExpr)
+				if !ok {
+					return true
+				}
+
+				x := fun.X
+				if isMethodExpr(p, fun) {
+					if !pointer || len(ce.Args) == 0 {
+						return true
+					}
+					if _, ok := p.TypeOf(x).(*types.Pointer); ok {
+						return true
+					}
+					arg := ce.Args[0]
+					if _, ok := arg.(*dst.CompositeLit); ok || isAddressableIn(p, arg) {
+						fixes = append(fixes, func() { ce.Args[0] = &dst.UnaryExpr{Op: token.AND, X: arg} })
+					} else {
+						err = fmt.Errorf("%s.%s is called on a value that can't be addressed", typeName, methodName)
+					}
+					return true
+				}
+				if !pointer {
+					if pe, ok := x.(*dst.ParenExpr); ok {
+						if ue, ok := pe.X.(*dst.UnaryExpr); ok && ue.Op == token.AND {
+							fixes = append(fixes, func() { fun.X = ue.X })
+						}
+					}
+					return true
+				}
+
+				if _, ok := p.TypeOf(x).(*types.Pointer); ok {
+					return true
+				}
+				if cl, ok := x.(*dst.CompositeLit); ok {
+					fixes = append(fixes, func() {
+						fun.X = &dst.ParenExpr{X: &dst.UnaryExpr{Op: token.AND, X: cl}}
+					})
+				} else if !isAddressableIn(p, x) {
+					err = fmt.Errorf("%s.%s is called on a value that can't be addressed", typeName, methodName)
+				}
+				return true
+			})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, fix := range fixes {
+		fix()
+	}
+	if pointer {
+		recvField.Type = &dst.StarExpr{X: recvField.Type}
+	} else {
+		recvField.Type = se.X
+	}
+	return nil
+}
+
+// MethodToFunc converts the method of the given type, declared in package pkg, into a function named
+// funcName, with the receiver as the first param, and rewrites the calls in pkgs, e.g. `t.m(x)` into
+// `funcName(t, x)`, taking the address of, or dereferencing, the receiver where needed. Methods of generic
+// types, implementing interfaces, or used other than called directly, and unexported funcName called
+// outside pkg are reported as errors.
+func MethodToFunc(pkgs []*Package, pkg *Package, typeName, methodName, funcName string) error {
+	fd, method, err := findMethod(pkg, typeName, methodName)
+	if err != nil {
+		return err
+	}
+	if pkg.Types.Scope().Lookup(funcName) != nil {
+		return fmt.Errorf("%s is already declared in package %s", funcName, pkg.PkgPath)
+	}
+	if fd.Recv.List[0].Type != nil {
+		switch recvType := fd.Recv.List[0].Type.(type) {
+		case *dst.IndexExpr, *dst.IndexListExpr:
+			return fmt.Errorf("method %s.%s of generic type can't be converted", typeName, methodName)
+		case *dst.StarExpr:
+			switch recvType.X.(type) {
+			case *dst.IndexExpr, *dst.IndexListExpr:
+				return fmt.Errorf("method %s.%s of generic type can't be converted", typeName, methodName)
+			}
+		}
+	}
+	if implementsInterface(pkgs, method) {
+		return fmt.Errorf("method %s.%s implements an interface", typeName, methodName)
+	}
+	_, pointer := fd.Recv.List[0].Type.(*dst.StarExpr)
+
+	var refs int
+	var fixes []func()
+	for _, p := range pkgs {
+		p := p
+		for _, df := range p.Files {
+			dst.Inspect(df, func(n dst.Node) bool {
+				switch nn := n.(type) {
+				case *dst.Ident:
+					if nn != fd.Name && p.ObjectOf(nn) == method {
+						refs++
+					}
+				case *dst.CallExpr:
+					fun, ok := nn.Fun.(*dst.SelectorExpr)
+					if !ok || calledFunc(p, nn) != method || isMethodExpr(p, fun) {
+						return true
+					}
+
+					if isPromotedMethod(p, fun) {
+						err = fmt.Errorf("%s.%s is called through an embedding type", typeName, methodName)
+						return true
+					}
+
+					recv := fun.X
+					for {
+						pe, ok := recv.(*dst.ParenExpr)
+						if !ok {
+							break
+						}
+						recv = pe.X
+					}
+					_, isPointer := p.TypeOf(recv).(*types.Pointer)
+					switch {
+					case pointer && !isPointer:
+						recv = &dst.UnaryExpr{Op: token.AND, X: recv}
+					case !pointer && isPointer:
+						recv = &dst.StarExpr{X: recv}
+					}
+
+					name := &dst.Ident{Name: funcName}
+					if p != pkg {
+						if !token.IsExported(funcName) {
+							err = fmt.Errorf("%s is called outside package %s, but %s is unexported", methodName, pkg.PkgPath, funcName)
+							return true
+						}
+						name.Path = pkg.PkgPath
+					}
+					fixes = append(fixes, func() {
+						nn.Fun = name
+						nn.Args = append([]dst.Expr{recv}, nn.Args...)
+					})
+				}
+				return true
+			})
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if refs > len(fixes) {
+		return fmt.Errorf("method %s.%s is used other than called directly", typeName, methodName)
+	}
+
+	for _, fix := range fixes {
+		fix()
+	}
+	recvField := fd.Recv.List[0]
+	if len(recvField.Names) == 0 {
+		recvField.Names = []*dst.Ident{dst.NewIdent("_")}
+	}
+	fd.Recv = nil
+	fd.Name.Name = funcName
+	fd.Type.Params.List = append([]*dst.Field{recvField}, fd.Type.Params.List...)
+	return nil
+}
+
+// findMethodDecl finds the declaration of the method of the given type
+func findMethodDecl(df *dst.File, typeName, methodName string) *dst.FuncDecl {
+	for _, decl := range df.Decls {
+		if fd, ok := decl.(*dst.FuncDecl); ok && fd.Recv != nil && fd.Body != nil &&
+			fd.Name.Name == methodName && receiverTypeName(fd) == typeName {
+			return fd
+		}
+	}
+	return nil
+}
+
+// findMethod finds the declaration and the object of the method of the given type declared in package pkg
+func findMethod(pkg *Package, typeName, methodName string) (*dst.FuncDecl, *types.Func, error) {
+	for _, df := range pkg.Files {
+		if fd := findMethodDecl(df, typeName, methodName); fd != nil {
+			method, ok := pkg.ObjectOf(fd.Name).(*types.Func)
+			if !ok {
+				return nil, nil, fmt.Errorf("method %s.%s is not type checked", typeName, methodName)
+			}
+			return fd, method, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("method %s.%s not found in package %s", typeName, methodName, pkg.PkgPath)
+}
+
+// isPromotedMethod checks if the method is selected through an embedded field, e.g. outer.m for outer.T.m
+func isPromotedMethod(p *Package, se *dst.SelectorExpr) bool {
+	ase, ok := p.dec.Ast.Nodes[se].(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := p.Info.Selections[ase]
+	return ok && len(sel.Index()) > 1
+}
+
+// isAddressableIn checks if the expression, in package p, is addressable, so that pointer methods can
+// be called on it
+func isAddressableIn(p *Package, expr dst.Expr) bool {
+	switch e := expr.(type) {
+	case *dst.Ident:
+		_, ok := p.ObjectOf(e).(*types.Var)
+		return ok
+	case *dst.ParenExpr:
+		return isAddressableIn(p, e.X)
+	case *dst.StarExpr:
+		return true
+	case *dst.SelectorExpr:
+		if _, ok := p.TypeOf(e.X).(*types.Pointer); ok {
+			return true
+		}
+		return isAddressableIn(p, e.X)
+	case *dst.IndexExpr:
+		t := p.TypeOf(e.X)
+		if t == nil {
+			return false
+		}
+		switch u := t.Underlying().(type) {
+		case *types.Slice:
+			return true
+		case *types.Pointer:
+			_, ok := u.Elem().Underlying().(*types.Array)
+			return ok
+		case *types.Array:
+			return isAddressableIn(p, e.X)
+		}
+	}
+	return false
+}
+
+// HasTypeParamInFuncDecl checks if the type params of the generic function, contains the given field
+func HasTypeParamInFuncDecl(df *dst.File, funcName string, field *dst.Field) (ret bool) {
+	if fd := findFuncDecl(df, funcName); fd != nil {
+		ret = hasFieldInFieldList(fd.Type.TypeParams, field)
+	}
+	return
+}
+
+// DeleteTypeParamFromFuncDecl deletes any field, in the type params of the generic function,
+// that is semantically equal to given field
+func DeleteTypeParamFromFuncDecl(df *dst.File, funcName string, field *dst.Field) (modified bool) {
+	if fd := findFuncDecl(df, funcName); fd != nil {
+		modified = deleteFieldFromFieldList(&fd.Type.TypeParams, field)
+	}
+	return
+}
+
+// AddTypeParamToFuncDecl adds given field, to the type params of the function, in the given position
+func AddTypeParamToFuncDecl(df *dst.File, funcName string, field *dst.Field, pos int) (modified bool) {
+	if fd := findFuncDecl(df, funcName); fd != nil {
+		addFieldToFieldList(&fd.Type.TypeParams, field, pos)
+		modified = true
+	}
+	return
+}
+
+// SetTypeParamConstraintOnFuncDecl sets the constraint of the type param of given name, of the generic function
+func SetTypeParamConstraintOnFuncDecl(df *dst.File, funcName, paramName string, constraint dst.Expr) (modified bool) {
+	if fd := findFuncDecl(df, funcName); fd != nil {
+		modified = setConstraintInFieldList(fd.Type.TypeParams, paramName, constraint)
+	}
+	return
+}
@@ -366,3 +366,485 @@ func TestAddFieldToFuncDeclParams(t *testing.T) {
 
 
 
+
+func TestTypeParamsOfFuncDecl(t *testing.T) {
+	var src = `
+	package main
+
+	func Map[T any](xs []T, f func(T) T) []T {
+		return xs
+	}
+	`
+
+	var expected = `
+	package main
+
+	func Map[K comparable, T Number](xs []T, f func(T) T) []T {
+		return xs
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	tParam := &dst.Field{Names: []*dst.Ident{dst.NewIdent("T")}, Type: dst.NewIdent("any")}
+	kParam := &dst.Field{Names: []*dst.Ident{dst.NewIdent("K")}, Type: dst.NewIdent("comparable")}
+
+	assert.True(t, HasTypeParamInFuncDecl(df, "Map", tParam))
+	assert.False(t, HasTypeParamInFuncDecl(df, "Map", kParam))
+	assert.True(t, AddTypeParamToFuncDecl(df, "Map", kParam, 0))
+	assert.True(t, HasTypeParamInFuncDecl(df, "Map", kParam))
+	assert.True(t, SetTypeParamConstraintOnFuncDecl(df, "Map", "T", dst.NewIdent("Number")))
+	assert.False(t, SetTypeParamConstraintOnFuncDecl(df, "Map", "V", dst.NewIdent("Number")))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+
+	assert.True(t, DeleteTypeParamFromFuncDecl(df, "Map", kParam))
+	assert.True(t, DeleteTypeParamFromFuncDecl(df, "Map", &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("T")},
+		Type:  dst.NewIdent("Number"),
+	}))
+	assertCodesEqual(t, `
+	package main
+
+	func Map(xs []T, f func(T) T) []T {
+		return xs
+	}
+	`, printToBuf(df).String())
+}
+
+func TestRemoveUnusedParamsOfGenericReceiver(t *testing.T) {
+	var src = `
+	package a
+
+	type S[T any] struct{ items []T }
+
+	func (s *S[T]) Add(item T, at int) { s.items = append(s.items, item) }
+
+	type M[K comparable, V any] map[K]V
+
+	func (m M[K, V]) Put(k K, v V, _ bool) { m[k] = v }
+
+	func main() {
+		s := &S[int]{}
+		s.Add(1, 0)
+		M[string, int]{}.Put("a", 1, true)
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(src)})
+	assert.Nil(t, err)
+
+	removed, err := RemoveUnusedParams([]*Package{pkg}, pkg, "S.Add")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"at"}, removed)
+	removed, err = RemoveUnusedParams([]*Package{pkg}, pkg, "M.Put")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"_"}, removed)
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, `
+	package a
+
+	type S[T any] struct{ items []T }
+
+	func (s *S[T]) Add(item T) { s.items = append(s.items, item) }
+
+	type M[K comparable, V any] map[K]V
+
+	func (m M[K, V]) Put(k K, v V) { m[k] = v }
+
+	func main() {
+		s := &S[int]{}
+		s.Add(1)
+		M[string, int]{}.Put("a", 1)
+	}
+	`, buf.String())
+}
+
+func TestDeleteGroupedFieldFromFuncDeclParams(t *testing.T) {
+	var src = `
+	package main
+
+	func f(a, b, c int, d string) {}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, DeleteFieldFromFuncDeclParams(df, "f", &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("b")},
+		Type:  dst.NewIdent("int"),
+	}))
+	assert.False(t, DeleteFieldFromFuncDeclParams(df, "f", &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("d")},
+		Type:  dst.NewIdent("int"),
+	}))
+	assertCodesEqual(t, `
+	package main
+
+	func f(a, c int, d string) {}
+	`, printToBuf(df).String())
+}
+
+func TestSetTypeParamConstraintKeepsOrder(t *testing.T) {
+	var src = `
+	package main
+
+	func F[A, B, C any]() {}
+
+	func G[A, B any]() {}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, SetTypeParamConstraintOnFuncDecl(df, "F", "B", dst.NewIdent("comparable")))
+	assert.True(t, SetTypeParamConstraintOnFuncDecl(df, "G", "B", dst.NewIdent("comparable")))
+	assertCodesEqual(t, `
+	package main
+
+	func F[A any, B comparable, C any]() {}
+
+	func G[A any, B comparable]() {}
+	`, printToBuf(df).String())
+}
+
+func TestEnsureFieldInFuncDeclParams(t *testing.T) {
+	var src = `
+	package main
+
+	func f(a int) {}
+	`
+
+	var expected = `
+	package main
+
+	func f(a int, b string) {}
+	`
+
+	field := &dst.Field{Names: []*dst.Ident{dst.NewIdent("b")}, Type: dst.NewIdent("string")}
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, EnsureFieldInFuncDeclParams(df, "f", field, -1))
+	assert.False(t, EnsureFieldInFuncDeclParams(df, "f", field, -1))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestRemoveUnusedParams(t *testing.T) {
+	var srcA = `
+	package a
+
+	import "io"
+
+	type T struct{}
+
+	func (t *T) Write(p []byte) (int, error) { return 0, nil }
+
+	func (t *T) log(ctx, msg string, _ int, opts ...int) { println(msg) }
+
+	func Sum(a, b, c int) int { return a + c }
+
+	func apply(f func(int, int, int) int) {}
+
+	var _ io.Writer = (*T)(nil)
+
+	func use() {
+		apply(Sum)
+	}
+	`
+
+	var srcB = `
+	package b
+
+	import "example.com/a"
+
+	func main() {
+		a.Sum(1, 2, 3)
+	}
+	`
+
+	var srcC = `
+	package a
+
+	type T struct{}
+
+	func (t *T) log(ctx, msg string, _ int, opts ...int) { println(msg) }
+
+	func Sum(a, b, c int) int { return a + c }
+
+	func main() {
+		t := &T{}
+		t.log("", "a", 1, 2, 3)
+		t.log("", "b", 1, []int{}...)
+		Sum(1, 2, 3)
+		Sum(1, f(), 3)
+	}
+
+	func f() int { return 0 }
+	`
+
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/a": {"a.go": []byte(srcA)},
+		"example.com/b": {"b.go": []byte(srcB)},
+	})
+	assert.Nil(t, err)
+
+	_, err = RemoveUnusedParams(pkgs, pkgs[0], "T.Write")
+	assert.NotNil(t, err)
+	_, err = RemoveUnusedParams(pkgs, pkgs[0], "Sum")
+	assert.NotNil(t, err)
+	_, err = RemoveUnusedParams(pkgs, pkgs[0], "missing")
+	assert.NotNil(t, err)
+
+	pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(srcC)})
+	assert.Nil(t, err)
+	_, err = RemoveUnusedParams([]*Package{pkg}, pkg, "Sum")
+	assert.NotNil(t, err)
+
+	removed, err := RemoveUnusedParams([]*Package{pkg}, pkg, "T.log")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ctx", "_", "opts"}, removed)
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, `
+	package a
+
+	type T struct{}
+
+	func (t *T) log(msg string) { println(msg) }
+
+	func Sum(a, b, c int) int { return a + c }
+
+	func main() {
+		t := &T{}
+		t.log("a")
+		t.log("b")
+		Sum(1, 2, 3)
+		Sum(1, f(), 3)
+	}
+
+	func f() int { return 0 }
+	`, buf.String())
+}
+
+func TestSetReceiverName(t *testing.T) {
+	var src = `
+	package a
+
+	type T struct{ n int }
+
+	func (this *T) Get() int {
+		f := func() int { return this.n }
+		return f()
+	}
+
+	func (this *T) Set(t int) { this.n = t }
+
+	func (T) Name() string { return "T" }
+	`
+
+	df, err := ParseSrcFileFromBytes([]byte(src))
+	assert.Nil(t, err)
+
+	assert.True(t, SetReceiverName(df, "T", "Get", "t"))
+	assert.False(t, SetReceiverName(df, "T", "Set", "t"))
+	assert.True(t, SetReceiverName(df, "T", "Name", "t"))
+	assert.False(t, SetReceiverName(df, "U", "Get", "u"))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, FprintFile(buf, df))
+	assertCodesEqual(t, `
+	package a
+
+	type T struct{ n int }
+
+	func (t *T) Get() int {
+		f := func() int { return t.n }
+		return f()
+	}
+
+	func (this *T) Set(t int) { this.n = t }
+
+	func (t T) Name() string { return "T" }
+	`, buf.String())
+}
+
+func TestSetReceiverPointer(t *testing.T) {
+	var srcA = `
+	package a
+
+	type T struct{ n int }
+
+	func (t T) Get() int { return t.n }
+
+	func (t T) String() string { return "T" }
+
+	func (t *T) Inc() { t.n++ }
+
+	type Stringer interface{ String() string }
+	`
+
+	var srcB = `
+	package b
+
+	import "example.com/a"
+
+	func main() {
+		t := a.T{}
+		t.Get()
+		a.T{}.Get()
+		(&t).Inc()
+		get := a.T.Get
+		a.T.Get(t)
+		println(get)
+	}
+	`
+
+	var srcC = `
+	package b
+
+	import "example.com/a"
+
+	func get() a.T { return a.T{} }
+
+	func main() {
+		get().Get()
+	}
+	`
+
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/a": {"a.go": []byte(srcA)},
+		"example.com/b": {"b.go": []byte(srcB)},
+	})
+	assert.Nil(t, err)
+
+	assert.NotNil(t, SetReceiverPointer(pkgs, pkgs[0], "T", "String", true))
+	assert.NotNil(t, SetReceiverPointer(pkgs, pkgs[0], "T", "missing", true))
+	assert.Nil(t, SetReceiverPointer(pkgs, pkgs[0], "T", "Get", true))
+	assert.Nil(t, SetReceiverPointer(pkgs, pkgs[0], "T", "Inc", false))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkgs[0].Fprint(buf, pkgs[0].Files[0]))
+	assertCodesEqual(t, `
+	package a
+
+	type T struct{ n int }
+
+	func (t *T) Get() int { return t.n }
+
+	func (t T) String() string { return "T" }
+
+	func (t T) Inc() { t.n++ }
+
+	type Stringer interface{ String() string }
+	`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, pkgs[1].Fprint(buf, pkgs[1].Files[0]))
+	assertCodesEqual(t, `
+	package b
+
+	import "example.com/a"
+
+	func main() {
+		t := a.T{}
+		t.Get()
+		(&a.T{}).Get()
+		t.Inc()
+		get := (*a.T).Get
+		(*a.T).Get(&t)
+		println(get)
+	}
+	`, buf.String())
+
+	pkgs, err = ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/a": {"a.go": []byte(srcA)},
+		"example.com/b": {"b.go": []byte(srcC)},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, SetReceiverPointer(pkgs, pkgs[0], "T", "Get", true))
+}
+
+func TestMethodToFunc(t *testing.T) {
+	var srcA = `
+	package a
+
+	type T struct{ n int }
+
+	func (t *T) Inc(d int) { t.n += d }
+
+	func (t T) Get() int { return t.n }
+
+	func (T) String() string { return "T" }
+
+	type Stringer interface{ String() string }
+
+	func use() {
+		t := T{}
+		t.Inc(1)
+		p := &t
+		p.Inc(2)
+		_ = p.Get()
+	}
+	`
+
+	var srcB = `
+	package b
+
+	import "example.com/a"
+
+	func main() {
+		t := &a.T{}
+		t.Inc(3)
+		f := t.Get
+		_ = f
+	}
+	`
+
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+		"example.com/a": {"a.go": []byte(srcA)},
+		"example.com/b": {"b.go": []byte(srcB)},
+	})
+	assert.Nil(t, err)
+
+	assert.NotNil(t, MethodToFunc(pkgs, pkgs[0], "T", "String", "String"))
+	assert.NotNil(t, MethodToFunc(pkgs, pkgs[0], "T", "Get", "Get"))
+	assert.NotNil(t, MethodToFunc(pkgs, pkgs[0], "T", "Inc", "use"))
+	assert.NotNil(t, MethodToFunc(pkgs, pkgs[0], "T", "Inc", "inc"))
+	assert.Nil(t, MethodToFunc(pkgs, pkgs[0], "T", "Inc", "Inc"))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkgs[0].Fprint(buf, pkgs[0].Files[0]))
+	assertCodesEqual(t, `
+	package a
+
+	type T struct{ n int }
+
+	func Inc(t *T, d int) { t.n += d }
+
+	func (t T) Get() int { return t.n }
+
+	func (T) String() string { return "T" }
+
+	type Stringer interface{ String() string }
+
+	func use() {
+		t := T{}
+		Inc(&t, 1)
+		p := &t
+		Inc(p, 2)
+		_ = p.Get()
+	}
+	`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, pkgs[1].Fprint(buf, pkgs[1].Files[0]))
+	assertCodesEqual(t, `
+	package b
+
+	import "example.com/a"
+
+	func main() {
+		t := &a.T{}
+		a.Inc(t, 3)
+		f := t.Get
+		_ = f
+	}
+	`, buf.String())
+}
@@ -1,8 +1,17 @@
 module github.com/ZhengHe-MD/gorefactor
 
-go 1.12
+go 1.19
 
 require (
-	github.com/dave/dst v0.23.1
-	github.com/stretchr/testify v1.3.0
+	github.com/dave/dst v0.27.3
+	github.com/stretchr/testify v1.4.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
+	golang.org/x/tools v0.1.12 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
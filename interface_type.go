@@ -0,0 +1,418 @@
+package gorefactor
+
+import (
+	"fmt"
+	"github.com/dave/dst"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// StubStyle decides the body of generated stub methods
+type StubStyle int
+
+const (
+	// StubZeroValues stubs return zero values of the results
+	StubZeroValues StubStyle = iota
+	// StubPanic stubs panic with "not implemented"
+	StubPanic
+)
+
+// HasMethodInInterface checks if the interface type has method of the given name
+func HasMethodInInterface(df *dst.File, ifaceName, methodName string) bool {
+	it := findInterfaceType(df, ifaceName)
+	return it != nil && findInterfaceMethod(it, methodName) != nil
+}
+
+// DeleteMethodFromInterface deletes the method of the given name from the interface type
+func DeleteMethodFromInterface(df *dst.File, ifaceName, methodName string) (modified bool) {
+	it := findInterfaceType(df, ifaceName)
+	if it == nil {
+		return
+	}
+
+	method := findInterfaceMethod(it, methodName)
+	if method == nil {
+		return
+	}
+	var newList []*dst.Field
+	for _, ff := range it.Methods.List {
+		if ff != method {
+			newList = append(newList, ff)
+		}
+	}
+	it.Methods.List = newList
+	return true
+}
+
+// AddMethodToInterface adds the method to the interface type declared in package pkg, and generates
+// stub methods, in the style given, on all concrete types in pkgs that implemented the interface before.
+func AddMethodToInterface(pkgs []*Package, pkg *Package, ifaceName string, method *dst.Field, style StubStyle) (modified bool) {
+	if len(method.Names) != 1 {
+		return
+	}
+	methodName := method.Names[0].Name
+
+	var it *dst.InterfaceType
+	for _, df := range pkg.Files {
+		if it = findInterfaceType(df, ifaceName); it != nil {
+			break
+		}
+	}
+	if it == nil || findInterfaceMethod(it, methodName) != nil {
+		return
+	}
+
+	var implementers []*types.Named
+	if obj, ok := pkg.Types.Scope().Lookup(ifaceName).(*types.TypeName); ok {
+		if iface, ok := obj.Type().Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+			implementers = findImplementers(pkgs, iface)
+		}
+	}
+
+	it.Methods.List = append(it.Methods.List, dst.Clone(method).(*dst.Field))
+	modified = true
+
+	ft, ok := method.Type.(*dst.FuncType)
+	if !ok {
+		return
+	}
+	for _, named := range implementers {
+		if hasMethod(named, methodName) {
+			continue
+		}
+		for _, p := range pkgs {
+			if p.Types != named.Obj().Pkg() {
+				continue
+			}
+			if df := findTypeSpecFile(p, named.Obj().Name()); df != nil {
+				df.Decls = append(df.Decls, stubMethod(pkg, p, named, methodName, ft, style))
+			}
+		}
+	}
+	return
+}
+
+// findImplementers finds named concrete types, declared in pkgs, implementing the interface
+func findImplementers(pkgs []*Package, iface *types.Interface) (implementers []*types.Named) {
+	for _, p := range pkgs {
+		scope := p.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			named, ok := tn.Type().(*types.Named)
+			if !ok || types.IsInterface(named) {
+				continue
+			}
+			if types.Implements(named, iface) || types.Implements(types.NewPointer(named), iface) {
+				implementers = append(implementers, named)
+			}
+		}
+	}
+	return
+}
+
+func hasMethod(named *types.Named, methodName string) bool {
+	for i := 0; i < named.NumMethods(); i++ {
+		if named.Method(i).Name() == methodName {
+			return true
+		}
+	}
+	return false
+}
+
+// stubMethod generates the method declaration, on the named type in package p, for the method of
+// interface declared in package ifacePkg
+func stubMethod(ifacePkg, p *Package, named *types.Named, methodName string, ft *dst.FuncType, style StubStyle) *dst.FuncDecl {
+	recvName := strings.ToLower(named.Obj().Name()[:1])
+
+	// generic types are received with their type params, e.g. G[T]
+	var baseType dst.Expr = dst.NewIdent(named.Obj().Name())
+	if tparams := named.TypeParams(); tparams.Len() > 0 {
+		var indices []dst.Expr
+		for i := 0; i < tparams.Len(); i++ {
+			indices = append(indices, dst.NewIdent(tparams.At(i).Obj().Name()))
+		}
+		if len(indices) == 1 {
+			baseType = &dst.IndexExpr{X: baseType, Index: indices[0]}
+		} else {
+			baseType = &dst.IndexListExpr{X: baseType, Indices: indices}
+		}
+	}
+	recvType := baseType
+	for i := 0; i < named.NumMethods(); i++ {
+		sig := named.Method(i).Type().(*types.Signature)
+		if sig.Recv().Name() != "" && sig.Recv().Name() != "_" {
+			recvName = sig.Recv().Name()
+		}
+		if _, ok := sig.Recv().Type().(*types.Pointer); ok {
+			recvType = &dst.StarExpr{X: baseType}
+		}
+	}
+
+	stubType := dst.Clone(ft).(*dst.FuncType)
+
+	// the receiver can't share the name of any param or result
+	taken := make(map[string]bool)
+	for _, fl := range []*dst.FieldList{stubType.Params, stubType.Results} {
+		if fl == nil {
+			continue
+		}
+		for _, field := range fl.List {
+			for _, ident := range field.Names {
+				taken[ident.Name] = true
+			}
+		}
+	}
+	for _, name := range []string{recvName, unexportedName(named.Obj().Name()), "_"} {
+		if !taken[name] {
+			recvName = name
+			break
+		}
+	}
+
+	var body []dst.Stmt
+	var results []*dst.Field
+	if stubType.Results != nil {
+		results = stubType.Results.List
+	}
+	ret := &dst.ReturnStmt{}
+	for _, field := range results {
+		zero := zeroValueOfTypeExpr(ifacePkg, field.Type)
+		if zero == nil {
+			style = StubPanic
+			break
+		}
+		for i := 0; i < len(field.Names) || i == 0; i++ {
+			ret.Results = append(ret.Results, dst.Clone(zero).(dst.Expr))
+		}
+	}
+	if style == StubPanic {
+		body = append(body, &dst.ExprStmt{X: &dst.CallExpr{
+			Fun:  dst.NewIdent("panic"),
+			Args: []dst.Expr{&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote("not implemented")}},
+		}})
+	} else if len(ret.Results) > 0 {
+		body = append(body, ret)
+	}
+
+	requalify(stubType, ifacePkg.PkgPath, p.PkgPath)
+	for _, stmt := range body {
+		requalify(stmt, ifacePkg.PkgPath, p.PkgPath)
+		stmt.Decorations().Before = dst.NewLine
+	}
+
+	fd := &dst.FuncDecl{
+		Recv: &dst.FieldList{List: []*dst.Field{{
+			Names: []*dst.Ident{dst.NewIdent(recvName)},
+			Type:  recvType,
+		}}},
+		Name: dst.NewIdent(methodName),
+		Type: stubType,
+		Body: &dst.BlockStmt{List: body},
+	}
+	fd.Decs.Before = dst.EmptyLine
+	return fd
+}
+
+// requalify rewrites the identifiers in the node, declared in package from, to be referred from package to
+func requalify(node dst.Node, from, to string) {
+	if from == to {
+		return
+	}
+	dst.Inspect(node, func(n dst.Node) bool {
+		switch nn := n.(type) {
+		case *dst.Field:
+			// names of params are not qualified
+			if nn.Type != nil {
+				requalify(nn.Type, from, to)
+			}
+			return false
+		case *dst.Ident:
+			if nn.Path == "" && types.Universe.Lookup(nn.Name) == nil {
+				nn.Path = from
+			} else if nn.Path == to {
+				nn.Path = ""
+			}
+		}
+		return true
+	})
+}
+
+// zeroValueOfTypeExpr returns the zero value of the type expression referred from package p, or nil if
+// the type can't be resolved
+func zeroValueOfTypeExpr(p *Package, expr dst.Expr) dst.Expr {
+	switch e := expr.(type) {
+	case *dst.StarExpr, *dst.MapType, *dst.ChanType, *dst.FuncType, *dst.InterfaceType:
+		return dst.NewIdent("nil")
+	case *dst.ArrayType:
+		if e.Len == nil {
+			return dst.NewIdent("nil")
+		}
+		return &dst.CompositeLit{Type: dst.Clone(e).(dst.Expr)}
+	case *dst.StructType:
+		return &dst.CompositeLit{Type: dst.Clone(e).(dst.Expr)}
+	case *dst.Ident:
+		var obj types.Object
+		if e.Path == "" {
+			obj = p.Types.Scope().Lookup(e.Name)
+			if obj == nil {
+				obj = types.Universe.Lookup(e.Name)
+			}
+		} else {
+			for _, imp := range p.Types.Imports() {
+				if imp.Path() == e.Path {
+					obj = imp.Scope().Lookup(e.Name)
+				}
+			}
+		}
+		if tn, ok := obj.(*types.TypeName); ok {
+			return zeroValue(tn.Type(), p.Types)
+		}
+	}
+	return nil
+}
+
+// zeroValue returns the zero value of the type, referred from package pkg
+func zeroValue(t types.Type, pkg *types.Package) dst.Expr {
+	if _, ok := t.(*types.TypeParam); ok {
+		return &dst.StarExpr{X: &dst.CallExpr{Fun: dst.NewIdent("new"), Args: []dst.Expr{typeExpr(t, pkg)}}}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return dst.NewIdent("false")
+		case u.Info()&types.IsString != 0:
+			return &dst.BasicLit{Kind: token.STRING, Value: `""`}
+		case u.Info()&types.IsNumeric != 0:
+			return &dst.BasicLit{Kind: token.INT, Value: "0"}
+		}
+	case *types.Struct, *types.Array:
+		return &dst.CompositeLit{Type: typeExpr(t, pkg)}
+	}
+	return dst.NewIdent("nil")
+}
+
+func findInterfaceType(df *dst.File, ifaceName string) *dst.InterfaceType {
+	if ts := findTypeSpec(df, ifaceName); ts != nil {
+		it, _ := ts.Type.(*dst.InterfaceType)
+		return it
+	}
+	return nil
+}
+
+func findInterfaceMethod(it *dst.InterfaceType, methodName string) *dst.Field {
+	for _, ff := range it.Methods.List {
+		for _, ident := range ff.Names {
+			if ident.Name == methodName {
+				return ff
+			}
+		}
+	}
+	return nil
+}
+
+func findTypeSpecFile(p *Package, typeName string) *dst.File {
+	for _, df := range p.Files {
+		if findTypeSpec(df, typeName) != nil {
+			return df
+		}
+	}
+	return nil
+}
+
+// ExtractInterface declares an interface type named ifaceName, after the declaration of type typeName
+// in package pkg, with all exported methods of the type, including the promoted ones. The params of type typeName, or pointer to it,
+// of functions named in funcNames are replaced with the interface.
+func ExtractInterface(pkg *Package, typeName, ifaceName string, funcNames ...string) error {
+	tn, ok := pkg.Types.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("type %s not found in package %s", typeName, pkg.PkgPath)
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || types.IsInterface(named) {
+		return fmt.Errorf("%s is not a concrete named type", typeName)
+	}
+	if pkg.Types.Scope().Lookup(ifaceName) != nil {
+		return fmt.Errorf("%s is already declared in package %s", ifaceName, pkg.PkgPath)
+	}
+
+	// methods declared are kept in order, followed by the ones promoted from embedded fields
+	var methods []*types.Func
+	var sigs []*types.Signature
+	for i := 0; i < named.NumMethods(); i++ {
+		methods = append(methods, named.Method(i))
+		sigs = append(sigs, named.Method(i).Type().(*types.Signature))
+	}
+	mset := types.NewMethodSet(types.NewPointer(named))
+	for i := 0; i < mset.Len(); i++ {
+		if sel := mset.At(i); len(sel.Index()) > 1 {
+			methods = append(methods, sel.Obj().(*types.Func))
+			sigs = append(sigs, sel.Type().(*types.Signature))
+		}
+	}
+
+	it := &dst.InterfaceType{Methods: &dst.FieldList{}}
+	for i, method := range methods {
+		if !method.Exported() {
+			continue
+		}
+		sig := sigs[i]
+		field := &dst.Field{
+			Names: []*dst.Ident{dst.NewIdent(method.Name())},
+			Type: &dst.FuncType{
+				Params:  tupleFieldList(sig.Params(), sig.Variadic(), pkg.Types),
+				Results: tupleFieldList(sig.Results(), false, pkg.Types),
+			},
+		}
+		field.Decs.Before = dst.NewLine
+		it.Methods.List = append(it.Methods.List, field)
+	}
+
+	gd := &dst.GenDecl{
+		Tok:   token.TYPE,
+		Specs: []dst.Spec{&dst.TypeSpec{Name: dst.NewIdent(ifaceName), Type: it}},
+	}
+	gd.Decs.Before = dst.EmptyLine
+
+	df := findTypeSpecFile(pkg, typeName)
+	if df == nil {
+		return fmt.Errorf("declaration of %s not found in package %s", typeName, pkg.PkgPath)
+	}
+	var decls []dst.Decl
+	for _, decl := range df.Decls {
+		decls = append(decls, decl)
+		if dd, ok := decl.(*dst.GenDecl); ok && dd.Tok == token.TYPE {
+			for _, spec := range dd.Specs {
+				if spec.(*dst.TypeSpec).Name.Name == typeName {
+					decls = append(decls, gd)
+				}
+			}
+		}
+	}
+	df.Decls = decls
+
+	for _, funcName := range funcNames {
+		for _, df := range pkg.Files {
+			fd := findFuncDecl(df, funcName)
+			if fd == nil {
+				continue
+			}
+			for _, field := range fd.Type.Params.List {
+				typ := field.Type
+				if se, ok := typ.(*dst.StarExpr); ok {
+					typ = se.X
+				}
+				if isIdentNamed(typ, typeName) {
+					field.Type = dst.NewIdent(ifaceName)
+				}
+			}
+		}
+	}
+	return nil
+}
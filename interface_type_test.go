@@ -0,0 +1,320 @@
+package gorefactor
+
+import (
+	"bytes"
+	"github.com/dave/dst"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHasMethodInInterface(t *testing.T) {
+	var src = `
+	package main
+
+	type Store interface {
+		Get(key string) (string, error)
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, HasMethodInInterface(df, "Store", "Get"))
+	assert.False(t, HasMethodInInterface(df, "Store", "Put"))
+	assert.False(t, HasMethodInInterface(df, "Getter", "Get"))
+}
+
+func TestDeleteMethodFromInterface(t *testing.T) {
+	var src = `
+	package main
+
+	type Store interface {
+		Get(key string) (string, error)
+		Put(key, value string) error
+	}
+	`
+
+	var expected = `
+	package main
+
+	type Store interface {
+		Get(key string) (string, error)
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, DeleteMethodFromInterface(df, "Store", "Put"))
+	assert.False(t, DeleteMethodFromInterface(df, "Store", "Put"))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestAddMethodToInterface(t *testing.T) {
+	var srcA = `
+	package a
+
+	type Value struct {
+		Data []byte
+	}
+
+	type Store interface {
+		Get(key string) (Value, error)
+	}
+
+	type memStore map[string]Value
+
+	func (m memStore) Get(key string) (Value, error) {
+		return m[key], nil
+	}
+	`
+
+	var srcB = `
+	package b
+
+	import "example.com/a"
+
+	type redisStore struct{}
+
+	func (rs *redisStore) Get(key string) (a.Value, error) {
+		return a.Value{}, nil
+	}
+
+	type other struct{}
+	`
+
+	method := &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("Put")},
+		Type: &dst.FuncType{
+			Params: &dst.FieldList{List: []*dst.Field{
+				{Names: []*dst.Ident{dst.NewIdent("key")}, Type: dst.NewIdent("string")},
+				{Names: []*dst.Ident{dst.NewIdent("v")}, Type: dst.NewIdent("Value")},
+			}},
+			Results: &dst.FieldList{List: []*dst.Field{
+				{Type: dst.NewIdent("Value")},
+				{Type: dst.NewIdent("int")},
+				{Type: dst.NewIdent("error")},
+			}},
+		},
+	}
+
+	t.Run("zero values", func(t *testing.T) {
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/b": {"b.go": []byte(srcB)},
+		})
+		assert.Nil(t, err)
+		a, b := pkgs[0], pkgs[1]
+
+		assert.True(t, AddMethodToInterface(pkgs, a, "Store", method, StubZeroValues))
+		assert.False(t, AddMethodToInterface(pkgs, a, "Store", method, StubZeroValues))
+
+		var expectedA = `
+		package a
+
+		type Value struct {
+			Data []byte
+		}
+
+		type Store interface {
+			Get(key string) (Value, error)
+			Put(key string, v Value) (Value, int, error)
+		}
+
+		type memStore map[string]Value
+
+		func (m memStore) Get(key string) (Value, error) {
+			return m[key], nil
+		}
+
+		func (m memStore) Put(key string, v Value) (Value, int, error) {
+			return Value{}, 0, nil
+		}
+		`
+
+		var expectedB = `
+		package b
+
+		import "example.com/a"
+
+		type redisStore struct{}
+
+		func (rs *redisStore) Get(key string) (a.Value, error) {
+			return a.Value{}, nil
+		}
+
+		type other struct{}
+
+		func (rs *redisStore) Put(key string, v a.Value) (a.Value, int, error) {
+			return a.Value{}, 0, nil
+		}
+		`
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, a.Fprint(buf, a.Files[0]))
+		assertCodesEqual(t, expectedA, buf.String())
+
+		buf = bytes.NewBuffer([]byte{})
+		assert.Nil(t, b.Fprint(buf, b.Files[0]))
+		assertCodesEqual(t, expectedB, buf.String())
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(srcA)})
+		assert.Nil(t, err)
+
+		assert.True(t, AddMethodToInterface([]*Package{pkg}, pkg, "Store", method, StubPanic))
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assert.Contains(t, buf.String(), `func (m memStore) Put(key string, v Value) (Value, int, error) {
+	panic("not implemented")
+}`)
+	})
+
+	t.Run("receiver name taken by params", func(t *testing.T) {
+		pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(srcA)})
+		assert.Nil(t, err)
+
+		method := &dst.Field{
+			Names: []*dst.Ident{dst.NewIdent("Merge")},
+			Type: &dst.FuncType{
+				Params: &dst.FieldList{List: []*dst.Field{
+					{Names: []*dst.Ident{dst.NewIdent("m")}, Type: dst.NewIdent("Store")},
+				}},
+			},
+		}
+		assert.True(t, AddMethodToInterface([]*Package{pkg}, pkg, "Store", method, StubZeroValues))
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assert.Contains(t, buf.String(), "func (memStore memStore) Merge(m Store) {}")
+	})
+
+	t.Run("generic implementers", func(t *testing.T) {
+		var src = `
+		package a
+
+		type Store interface {
+			Len() int
+		}
+
+		type cache[K comparable, V any] struct {
+			m map[K]V
+		}
+
+		func (c *cache[K, V]) Len() int {
+			return len(c.m)
+		}
+
+		type list[T any] []T
+
+		func (l list[T]) Len() int {
+			return len(l)
+		}
+		`
+
+		pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(src)})
+		assert.Nil(t, err)
+
+		method := &dst.Field{
+			Names: []*dst.Ident{dst.NewIdent("Reset")},
+			Type:  &dst.FuncType{Params: &dst.FieldList{}},
+		}
+		assert.True(t, AddMethodToInterface([]*Package{pkg}, pkg, "Store", method, StubZeroValues))
+
+		buf := bytes.NewBuffer([]byte{})
+		assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+		assert.Contains(t, buf.String(), "func (c *cache[K, V]) Reset() {}")
+		assert.Contains(t, buf.String(), "func (l list[T]) Reset() {}")
+	})
+}
+
+func TestExtractInterface(t *testing.T) {
+	var src = `
+	package a
+
+	import "io"
+
+	type Client struct{}
+
+	func (c *Client) Get(key string) ([]byte, error) {
+		return nil, nil
+	}
+
+	func (c *Client) Copy(w io.Writer, keys ...string) {}
+
+	func (c *Client) reset() {}
+
+	func Use(c *Client, n int) {
+		c.Get("key")
+	}
+
+	func Keep(c *Client) {}
+	`
+
+	var expected = `
+	package a
+
+	import "io"
+
+	type Client struct{}
+
+	type Getter interface {
+		Get(key string) ([]byte, error)
+		Copy(w io.Writer, keys ...string)
+	}
+
+	func (c *Client) Get(key string) ([]byte, error) {
+		return nil, nil
+	}
+
+	func (c *Client) Copy(w io.Writer, keys ...string) {}
+
+	func (c *Client) reset() {}
+
+	func Use(c Getter, n int) {
+		c.Get("key")
+	}
+
+	func Keep(c *Client) {}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(src)})
+	assert.Nil(t, err)
+	assert.Nil(t, ExtractInterface(pkg, "Client", "Getter", "Use"))
+	assert.NotNil(t, ExtractInterface(pkg, "Missing", "Getter"))
+	assert.NotNil(t, ExtractInterface(pkg, "Client", "Use"))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assertCodesEqual(t, expected, buf.String())
+}
+
+func TestExtractInterfacePromotedMethods(t *testing.T) {
+	var src = `
+	package a
+
+	type Base struct{}
+
+	func (Base) X() int { return 0 }
+
+	func (b *Base) Reset() {}
+
+	func (b *Base) y() {}
+
+	type Outer struct {
+		Base
+	}
+
+	func (o *Outer) Get() string { return "" }
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(src)})
+	assert.Nil(t, err)
+	assert.Nil(t, ExtractInterface(pkg, "Outer", "Getter"))
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	assert.Contains(t, buf.String(), `type Getter interface {
+	Get() string
+	Reset()
+	X() int
+}`)
+}
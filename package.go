@@ -0,0 +1,367 @@
+package gorefactor
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/decorator/resolver/gotypes"
+	"github.com/dave/dst/decorator/resolver/guess"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultImporter type checks packages not loaded by the user from source, it
+// is shared so that the standard library is only checked once.
+var defaultImporter = importer.ForCompiler(defaultFileSet, "source", nil).(types.ImporterFrom)
+
+// Package is a type checked go package, whose files are parsed into *dst.File.
+// Utilities that need type information work on a Package instead of a single file.
+type Package struct {
+	Name    string
+	PkgPath string
+	Dir     string
+	Files   []*dst.File
+	Types   *types.Package
+	Info    *types.Info
+
+	dec       *decorator.Decorator
+	filenames []string
+	astFiles  []*ast.File
+	names     map[string]string
+}
+
+// LoadPackage loads the go package with the given import path from dir
+func LoadPackage(pkgPath, dir string) (*Package, error) {
+	pkgs, err := LoadPackages(map[string]string{pkgPath: dir})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs[0], nil
+}
+
+// LoadPackages loads the go packages given as a map from import path to dir. Packages
+// importing each other are type checked against the loaded ones.
+func LoadPackages(dirs map[string]string) ([]*Package, error) {
+	srcs := make(map[string]map[string][]byte)
+	for pkgPath, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		srcs[pkgPath] = make(map[string][]byte)
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+				continue
+			}
+
+			src, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			srcs[pkgPath][filepath.Join(dir, name)] = src
+		}
+	}
+	return parsePackages(srcs, dirs)
+}
+
+// ParsePackageFromBytes parses the go package with the given import path, from a map of
+// filename to src file in the form of bytes
+func ParsePackageFromBytes(pkgPath string, srcs map[string][]byte) (*Package, error) {
+	pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{pkgPath: srcs})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs[0], nil
+}
+
+// ParsePackagesFromBytes parses the go packages given as a map from import path to src files
+func ParsePackagesFromBytes(srcs map[string]map[string][]byte) ([]*Package, error) {
+	return parsePackages(srcs, nil)
+}
+
+func parsePackages(srcs map[string]map[string][]byte, dirs map[string]string) ([]*Package, error) {
+	l := &loader{
+		pkgs:     make(map[string]*Package),
+		checking: make(map[string]bool),
+	}
+	// names of all packages loaded together, so that references among them
+	// are printed correctly even if not imported yet
+	names := make(map[string]string)
+
+	var paths []string
+	for pkgPath := range srcs {
+		paths = append(paths, pkgPath)
+	}
+	sort.Strings(paths)
+
+	for _, pkgPath := range paths {
+		var filenames []string
+		for filename := range srcs[pkgPath] {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+
+		p := &Package{PkgPath: pkgPath, Dir: dirs[pkgPath], names: names}
+		for _, filename := range filenames {
+			af, err := parser.ParseFile(defaultFileSet, filename, srcs[pkgPath][filename], parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+			p.Name = af.Name.Name
+			p.filenames = append(p.filenames, filename)
+			p.astFiles = append(p.astFiles, af)
+		}
+		if len(p.astFiles) == 0 {
+			return nil, fmt.Errorf("no go files found for package %s", pkgPath)
+		}
+		names[pkgPath] = p.Name
+		l.pkgs[pkgPath] = p
+	}
+
+	var pkgs []*Package
+	for _, pkgPath := range paths {
+		p, err := l.load(pkgPath)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// loader type checks a set of packages, resolving imports among them before
+// falling back to the default importer
+type loader struct {
+	pkgs     map[string]*Package
+	checking map[string]bool
+}
+
+func (l *loader) Import(path string) (*types.Package, error) {
+	return l.ImportFrom(path, "", 0)
+}
+
+func (l *loader) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if _, ok := l.pkgs[path]; ok {
+		p, err := l.load(path)
+		if err != nil {
+			return nil, err
+		}
+		return p.Types, nil
+	}
+	return defaultImporter.ImportFrom(path, dir, mode)
+}
+
+func (l *loader) load(pkgPath string) (*Package, error) {
+	p := l.pkgs[pkgPath]
+	if p.Types != nil {
+		return p, nil
+	}
+	if l.checking[pkgPath] {
+		return nil, fmt.Errorf("import cycle through package %s", pkgPath)
+	}
+	l.checking[pkgPath] = true
+
+	p.Info = &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Implicits:  make(map[ast.Node]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:     make(map[ast.Node]*types.Scope),
+	}
+	// code under migration doesn't always compile, so type errors are ignored and
+	// whatever could be inferred is kept.
+	conf := types.Config{Importer: l, Error: func(err error) {}}
+	p.Types, _ = conf.Check(pkgPath, defaultFileSet, p.astFiles, p.Info)
+
+	p.dec = decorator.NewDecoratorWithImports(defaultFileSet, pkgPath, localResolver{
+		DecoratorResolver: gotypes.New(p.Info.Uses),
+		path:              pkgPath,
+	})
+	for i, af := range p.astFiles {
+		df, err := p.dec.DecorateFile(af)
+		if err != nil {
+			return nil, err
+		}
+		p.dec.Filenames[df] = p.filenames[i]
+		p.Files = append(p.Files, df)
+	}
+	return p, nil
+}
+
+// localResolver leaves the path of identifiers declared in the package itself empty, so
+// that files in a Package look the same as the ones parsed by ParseSrcFile
+type localResolver struct {
+	*gotypes.DecoratorResolver
+	path string
+}
+
+func (r localResolver) ResolveIdent(file *ast.File, parent ast.Node, parentField string, id *ast.Ident) (string, error) {
+	path, err := r.DecoratorResolver.ResolveIdent(file, parent, parentField, id)
+	if path == r.path {
+		return "", err
+	}
+	return path, err
+}
+
+// Filename returns the name of the file the given *dst.File is parsed from
+func (p *Package) Filename(df *dst.File) string {
+	return p.dec.Filenames[df]
+}
+
+// ObjectOf returns the object denoted by the given identifier, or nil if not found
+func (p *Package) ObjectOf(ident *dst.Ident) types.Object {
+	switch n := p.dec.Ast.Nodes[ident].(type) {
+	case *ast.Ident:
+		return p.Info.ObjectOf(n)
+	case *ast.SelectorExpr:
+		return p.Info.ObjectOf(n.Sel)
+	}
+	return nil
+}
+
+// TypeOf returns the type of the given expression, or nil if not found
+func (p *Package) TypeOf(expr dst.Expr) types.Type {
+	if ident, ok := expr.(*dst.Ident); ok {
+		if obj := p.ObjectOf(ident); obj != nil {
+			if _, ok := obj.(*types.PkgName); !ok {
+				return obj.Type()
+			}
+		}
+	}
+	if n, ok := p.dec.Ast.Nodes[expr].(ast.Expr); ok {
+		return p.Info.TypeOf(n)
+	}
+	return nil
+}
+
+// Fprint writes the *dst.File, which belongs to the package, out to io.Writer
+func (p *Package) Fprint(out io.Writer, df *dst.File) error {
+	names := make(map[string]string)
+	if p.Types != nil {
+		for _, imp := range p.Types.Imports() {
+			names[imp.Path()] = imp.Name()
+		}
+	}
+	for path, name := range p.names {
+		names[path] = name
+	}
+	res := decorator.NewRestorerWithImports(p.PkgPath, guess.WithMap(names))
+	return res.Fprint(out, df)
+}
+
+// Save writes all files of the package back to where they are loaded from
+func (p *Package) Save() error {
+	for _, df := range p.Files {
+		buf := &bytes.Buffer{}
+		if err := p.Fprint(buf, df); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p.Filename(df), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeExpr converts the type into an expression referring to it from package pkg
+func typeExpr(t types.Type, pkg *types.Package) dst.Expr {
+	switch tt := t.(type) {
+	case *types.Basic:
+		return dst.NewIdent(tt.Name())
+	case *types.Named:
+		obj := tt.Obj()
+		var expr dst.Expr = &dst.Ident{Name: obj.Name()}
+		if obj.Pkg() != nil && obj.Pkg() != pkg {
+			expr = &dst.Ident{Name: obj.Name(), Path: obj.Pkg().Path()}
+		}
+
+		var args []dst.Expr
+		for i := 0; i < tt.TypeArgs().Len(); i++ {
+			args = append(args, typeExpr(tt.TypeArgs().At(i), pkg))
+		}
+		switch len(args) {
+		case 0:
+			return expr
+		case 1:
+			return &dst.IndexExpr{X: expr, Index: args[0]}
+		default:
+			return &dst.IndexListExpr{X: expr, Indices: args}
+		}
+	case *types.TypeParam:
+		return dst.NewIdent(tt.Obj().Name())
+	case *types.Pointer:
+		return &dst.StarExpr{X: typeExpr(tt.Elem(), pkg)}
+	case *types.Slice:
+		return &dst.ArrayType{Elt: typeExpr(tt.Elem(), pkg)}
+	case *types.Array:
+		return &dst.ArrayType{
+			Len: &dst.BasicLit{Kind: token.INT, Value: strconv.FormatInt(tt.Len(), 10)},
+			Elt: typeExpr(tt.Elem(), pkg),
+		}
+	case *types.Map:
+		return &dst.MapType{Key: typeExpr(tt.Key(), pkg), Value: typeExpr(tt.Elem(), pkg)}
+	case *types.Chan:
+		dir := dst.SEND | dst.RECV
+		switch tt.Dir() {
+		case types.SendOnly:
+			dir = dst.SEND
+		case types.RecvOnly:
+			dir = dst.RECV
+		}
+		return &dst.ChanType{Dir: dir, Value: typeExpr(tt.Elem(), pkg)}
+	case *types.Signature:
+		return &dst.FuncType{
+			Func:    true,
+			Params:  tupleFieldList(tt.Params(), tt.Variadic(), pkg),
+			Results: tupleFieldList(tt.Results(), false, pkg),
+		}
+	}
+
+	// struct and interface literals are rare enough to go through the printed form
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	expr, err := parseExpr(types.TypeString(t, qualifier))
+	if err != nil {
+		return dst.NewIdent(types.TypeString(t, qualifier))
+	}
+	return expr
+}
+
+// tupleFieldList converts the params or results of a function signature into *dst.FieldList
+func tupleFieldList(tuple *types.Tuple, variadic bool, pkg *types.Package) *dst.FieldList {
+	fl := &dst.FieldList{}
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+
+		field := &dst.Field{Type: typeExpr(v.Type(), pkg)}
+		if variadic && i == tuple.Len()-1 {
+			field.Type = &dst.Ellipsis{Elt: typeExpr(v.Type().(*types.Slice).Elem(), pkg)}
+		}
+		if v.Name() != "" {
+			field.Names = []*dst.Ident{dst.NewIdent(v.Name())}
+		}
+		fl.List = append(fl.List, field)
+	}
+	return fl
+}
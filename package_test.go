@@ -0,0 +1,133 @@
+package gorefactor
+
+import (
+	"bytes"
+	"github.com/dave/dst"
+	"github.com/stretchr/testify/assert"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePackagesFromBytes(t *testing.T) {
+	t.Run("import each other", func(t *testing.T) {
+		var srcA = `
+		package a
+
+		type Client struct{}
+		`
+
+		var srcB = `
+		package b
+
+		import "example.com/a"
+
+		func New() *a.Client {
+			return &a.Client{}
+		}
+		`
+
+		pkgs, err := ParsePackagesFromBytes(map[string]map[string][]byte{
+			"example.com/a": {"a.go": []byte(srcA)},
+			"example.com/b": {"b.go": []byte(srcB)},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(pkgs))
+		assert.Equal(t, "a", pkgs[0].Name)
+		assert.Equal(t, "b", pkgs[1].Name)
+
+		fd := pkgs[1].Files[0].Decls[1].(*dst.FuncDecl)
+		rs := fd.Body.List[0].(*dst.ReturnStmt)
+		ue := rs.Results[0].(*dst.UnaryExpr)
+		ident := ue.X.(*dst.CompositeLit).Type.(*dst.Ident)
+		assert.Equal(t, "example.com/a", ident.Path)
+		assert.Equal(t, pkgs[0].Types.Scope().Lookup("Client"), pkgs[1].ObjectOf(ident))
+		assert.Equal(t, "*example.com/a.Client", types.TypeString(pkgs[1].TypeOf(ue), nil))
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte("package a\nfunc {")})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLoadPackage(t *testing.T) {
+	var src = `
+	package a
+
+	import "fmt"
+
+	func Hello() {
+		fmt.Println("hello")
+	}
+	`
+
+	dir, err := ioutil.TempDir("", "gorefactor")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "a.go")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(src), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a_test.go"), []byte("package a"), 0644))
+
+	pkg, err := LoadPackage("example.com/a", dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pkg.Files))
+	assert.Equal(t, filename, pkg.Filename(pkg.Files[0]))
+
+	assert.True(t, SetMethodOnReceiver(pkg.Files[0], EmptyScope, "fmt", "Println", "Print"))
+	assert.Nil(t, pkg.Save())
+
+	buf := bytes.NewBuffer([]byte{})
+	assert.Nil(t, pkg.Fprint(buf, pkg.Files[0]))
+	saved, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, buf.String(), string(saved))
+	assertCodesEqual(t, `
+	package a
+
+	import "fmt"
+
+	func Hello() {
+		fmt.Print("hello")
+	}
+	`, string(saved))
+}
+
+func TestParseGenericPackage(t *testing.T) {
+	var src = `
+	package a
+
+	type List[T any] struct {
+		items []T
+	}
+
+	func Map[T, U any](xs []T, f func(T) U) []U {
+		return nil
+	}
+
+	func main() {
+		var l List[int]
+		_ = Map[int, string](l.items, nil)
+	}
+	`
+
+	pkg, err := ParsePackageFromBytes("example.com/a", map[string][]byte{"a.go": []byte(src)})
+	assert.Nil(t, err)
+
+	fd := pkg.Files[0].Decls[2].(*dst.FuncDecl)
+	ds := fd.Body.List[0].(*dst.DeclStmt)
+	vs := ds.Decl.(*dst.GenDecl).Specs[0].(*dst.ValueSpec)
+	lt := pkg.TypeOf(vs.Names[0])
+	assert.Equal(t, "example.com/a.List[int]", types.TypeString(lt, nil))
+
+	as := fd.Body.List[1].(*dst.AssignStmt)
+	ce := as.Rhs[0].(*dst.CallExpr)
+	assert.Equal(t, "[]string", types.TypeString(pkg.TypeOf(ce), nil))
+
+	assert.True(t, nodesEqual(&dst.IndexExpr{X: dst.NewIdent("List"), Index: dst.NewIdent("int")}, typeExpr(lt, pkg.Types)))
+	tp := pkg.Types.Scope().Lookup("Map").Type().(*types.Signature).TypeParams().At(0)
+	assert.True(t, nodesEqual(dst.NewIdent("T"), typeExpr(tp, pkg.Types)))
+}
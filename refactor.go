@@ -1,6 +1,8 @@
 package gorefactor
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
 	"github.com/dave/dst/decorator/resolver/goast"
@@ -9,6 +11,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 )
 
 var defaultFileSet = token.NewFileSet()
@@ -22,6 +26,33 @@ func ParseSrcFileFromBytes(src []byte) (df *dst.File, err error) {
 	return dec.Parse(src)
 }
 
+// ParseStmts parses the given snippet of go statements into []dst.Stmt, comments in the snippet are kept.
+// Identifiers qualified by the packages of the given imports are resolved, so that the imports are added
+// when the file, the statements are inserted into, is printed. An import is either a path, or a name and
+// a path separated by space, e.g. "opentracing github.com/opentracing/opentracing-go".
+func ParseStmts(src string, imports ...string) ([]dst.Stmt, error) {
+	var buf bytes.Buffer
+	buf.WriteString("package main\n\n")
+	for _, imp := range imports {
+		// the name is given when it's not the same as the last element of the path
+		if fields := strings.Fields(imp); len(fields) == 2 {
+			fmt.Fprintf(&buf, "import %s %s\n", fields[0], strconv.Quote(fields[1]))
+		} else {
+			fmt.Fprintf(&buf, "import %s\n", strconv.Quote(imp))
+		}
+	}
+	buf.WriteString("\nfunc _() {\n")
+	buf.WriteString(src)
+	buf.WriteString("\n}\n")
+
+	df, err := ParseSrcFileFromBytes(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	fd := df.Decls[len(df.Decls)-1].(*dst.FuncDecl)
+	return fd.Body.List, nil
+}
+
 // ParseSrcFile parses the given go src filename, in the form of valid path, into *dst.File
 func ParseSrcFile(filename string) (df *dst.File, err error) {
 	f, err := os.Open(filename)
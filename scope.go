@@ -6,14 +6,32 @@ import (
 
 type Scope struct {
 	FuncName string
+	// FuncDecl, if set, limits the scope to the very declaration, rather than every function or method
+	// named FuncName, e.g. (A) Close but not (B) Close
+	FuncDecl *dst.FuncDecl
+	// Traversal decides which of the nested function calls matched are visited, e.g. f(f())
+	Traversal Traversal
 
 	currentScopeNode dst.Node
 }
 
+// Traversal decides which of the function calls matched are visited, when they are nested in
+// the args of each other, e.g. f(f()), or chained, e.g. b.With(x).With(y)
+type Traversal int
+
+const (
+	// TraverseAll visits all matched calls
+	TraverseAll Traversal = iota
+	// TraverseOutermost visits matched calls not nested in another matched call
+	TraverseOutermost
+	// TraverseInnermost visits matched calls having no matched call nested in them
+	TraverseInnermost
+)
+
 var EmptyScope = Scope{}
 
 func (s Scope) isEmptyScope() bool {
-	return s == EmptyScope
+	return s.FuncName == "" && s.FuncDecl == nil
 }
 
 func (s Scope) IsInScope() bool {
@@ -27,7 +45,7 @@ func (s *Scope) TryEnterScope(node dst.Node) (ok bool) {
 	switch node.(type) {
 	case *dst.FuncDecl:
 		nn := node.(*dst.FuncDecl)
-		if nn.Name.Name == s.FuncName {
+		if (s.FuncDecl == nil && nn.Name.Name == s.FuncName) || (s.FuncDecl != nil && nn == s.FuncDecl) {
 			s.currentScopeNode = nn
 			ok = true
 		}
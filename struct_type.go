@@ -0,0 +1,329 @@
+package gorefactor
+
+import (
+	"github.com/dave/dst"
+	"github.com/dave/dst/dstutil"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// HasFieldInStruct checks if the struct type has field of the given name, embedded fields are named
+// by their type name
+func HasFieldInStruct(df *dst.File, typeName, fieldName string) (ret bool) {
+	if st := findStructType(df, typeName); st != nil {
+		_, _, ret = findStructField(st, fieldName)
+	}
+	return
+}
+
+// AddFieldToStruct adds given field, to the fields of the struct type, in the given position.
+// An embedded field is added when the field has no names.
+func AddFieldToStruct(df *dst.File, typeName string, field *dst.Field, pos int) (modified bool) {
+	st := findStructType(df, typeName)
+	if st == nil {
+		return
+	}
+
+	fieldList := st.Fields.List
+	pos = normalizePos(pos, len(fieldList))
+	st.Fields.List = append(
+		fieldList[:pos],
+		append([]*dst.Field{dst.Clone(field).(*dst.Field)}, fieldList[pos:]...)...)
+	return true
+}
+
+// DeleteFieldFromStruct deletes the field of the given name from the struct type, together with the
+// elements of it in the composite literals of the struct type, either keyed or positional
+func DeleteFieldFromStruct(df *dst.File, typeName, fieldName string) (modified bool) {
+	st := findStructType(df, typeName)
+	if st == nil {
+		return
+	}
+
+	field, i, ok := findStructField(st, fieldName)
+	if !ok {
+		return
+	}
+
+	// index of the field in unkeyed composite literals, e.g. T{1, 2}
+	var index int
+	for _, ff := range st.Fields.List {
+		if ff == field {
+			index += i
+			break
+		}
+		if len(ff.Names) == 0 {
+			index++
+		}
+		index += len(ff.Names)
+	}
+
+	if len(field.Names) > 1 {
+		field.Names = append(field.Names[:i], field.Names[i+1:]...)
+	} else {
+		var newList []*dst.Field
+		for _, ff := range st.Fields.List {
+			if ff != field {
+				newList = append(newList, ff)
+			}
+		}
+		st.Fields.List = newList
+	}
+
+	applyToCompositeLits(df, typeName, func(cl *dst.CompositeLit) {
+		var newElts []dst.Expr
+		for j, elt := range cl.Elts {
+			kv, keyed := elt.(*dst.KeyValueExpr)
+			if (keyed && isIdentNamed(kv.Key, fieldName)) || (!keyed && j == index) {
+				continue
+			}
+			newElts = append(newElts, elt)
+		}
+		cl.Elts = newElts
+	})
+	return true
+}
+
+// RenameFieldInStruct renames the field of the struct type, together with the keys of it
+// in the composite literals of the struct type
+func RenameFieldInStruct(df *dst.File, typeName, oldName, newName string) (modified bool) {
+	st := findStructType(df, typeName)
+	if st == nil {
+		return
+	}
+
+	field, i, ok := findStructField(st, oldName)
+	if !ok || len(field.Names) == 0 {
+		return
+	}
+	field.Names[i].Name = newName
+
+	applyToCompositeLits(df, typeName, func(cl *dst.CompositeLit) {
+		for _, elt := range cl.Elts {
+			if kv, ok := elt.(*dst.KeyValueExpr); ok && isIdentNamed(kv.Key, oldName) {
+				kv.Key.(*dst.Ident).Name = newName
+			}
+		}
+	})
+	return true
+}
+
+// SetTagOnStructField sets the value of the given key in the tag of the struct field, e.g. key json
+// and value "name,omitempty". The key is appended to the tag if it's not there.
+func SetTagOnStructField(df *dst.File, typeName, fieldName, key, value string) (modified bool) {
+	return updateStructFieldTag(df, typeName, fieldName, func(tags []structTag) []structTag {
+		for i := range tags {
+			if tags[i].key == key {
+				tags[i].value = value
+				return tags
+			}
+		}
+		return append(tags, structTag{key: key, value: value})
+	})
+}
+
+// DeleteTagFromStructField deletes the given key from the tag of the struct field
+func DeleteTagFromStructField(df *dst.File, typeName, fieldName, key string) (modified bool) {
+	return updateStructFieldTag(df, typeName, fieldName, func(tags []structTag) []structTag {
+		var newTags []structTag
+		for _, tag := range tags {
+			if tag.key != key {
+				newTags = append(newTags, tag)
+			}
+		}
+		return newTags
+	})
+}
+
+// SetTagOptionOnStructField turns on or off an option, like omitempty, of the given key in the tag
+// of the struct field. Nothing happens if the key is not in the tag.
+func SetTagOptionOnStructField(df *dst.File, typeName, fieldName, key, option string, on bool) (modified bool) {
+	return updateStructFieldTag(df, typeName, fieldName, func(tags []structTag) []structTag {
+		for i := range tags {
+			if tags[i].key != key {
+				continue
+			}
+
+			parts := strings.Split(tags[i].value, ",")
+			var newParts []string
+			for j, part := range parts {
+				if j == 0 || part != option {
+					newParts = append(newParts, part)
+				}
+			}
+			if on {
+				newParts = append(newParts, option)
+			}
+			tags[i].value = strings.Join(newParts, ",")
+		}
+		return tags
+	})
+}
+
+type structTag struct {
+	key, value string
+}
+
+// parseStructTag parses the tag, without back quotes, in the conventional format of reflect.StructTag
+func parseStructTag(tag string) (tags []structTag, ok bool) {
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			return tags, true
+		}
+
+		i := strings.Index(tag, ":\"")
+		if i <= 0 || strings.ContainsAny(tag[:i], " \"") {
+			return nil, false
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		quoted, err := strconv.QuotedPrefix(tag)
+		if err != nil {
+			return nil, false
+		}
+		value, _ := strconv.Unquote(quoted)
+		tags = append(tags, structTag{key: key, value: value})
+		tag = tag[len(quoted):]
+	}
+}
+
+func updateStructFieldTag(df *dst.File, typeName, fieldName string, update func([]structTag) []structTag) (modified bool) {
+	st := findStructType(df, typeName)
+	if st == nil {
+		return
+	}
+	field, _, ok := findStructField(st, fieldName)
+	if !ok {
+		return
+	}
+
+	var tags []structTag
+	if field.Tag != nil {
+		raw, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return
+		}
+		if tags, ok = parseStructTag(raw); !ok {
+			return
+		}
+	}
+
+	var parts []string
+	for _, tag := range update(append([]structTag{}, tags...)) {
+		parts = append(parts, tag.key+":"+strconv.Quote(tag.value))
+	}
+
+	var oldValue string
+	if field.Tag != nil {
+		oldValue = field.Tag.Value
+	}
+	newValue := "`" + strings.Join(parts, " ") + "`"
+	if len(parts) == 0 {
+		newValue = ""
+	}
+	if newValue == oldValue {
+		return
+	}
+
+	if newValue == "" {
+		field.Tag = nil
+	} else {
+		field.Tag = &dst.BasicLit{Kind: token.STRING, Value: newValue}
+	}
+	return true
+}
+
+func findStructType(df *dst.File, typeName string) *dst.StructType {
+	if ts := findTypeSpec(df, typeName); ts != nil {
+		st, _ := ts.Type.(*dst.StructType)
+		return st
+	}
+	return nil
+}
+
+// findStructField finds the field of the given name and the index of the name in the field
+func findStructField(st *dst.StructType, fieldName string) (*dst.Field, int, bool) {
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 && embeddedTypeName(field.Type) == fieldName {
+			return field, 0, true
+		}
+		for i, ident := range field.Names {
+			if ident.Name == fieldName {
+				return field, i, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+func embeddedTypeName(expr dst.Expr) string {
+	switch e := expr.(type) {
+	case *dst.StarExpr:
+		return embeddedTypeName(e.X)
+	case *dst.SelectorExpr:
+		return e.Sel.Name
+	case *dst.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+func isIdentNamed(expr dst.Expr, name string) bool {
+	ident, ok := expr.(*dst.Ident)
+	return ok && ident.Path == "" && ident.Name == name
+}
+
+// applyToCompositeLits calls fn on every composite literal of the type in the file, including the ones
+// whose type is elided in the composite literals of slice, array or map
+func applyToCompositeLits(df *dst.File, typeName string, fn func(cl *dst.CompositeLit)) {
+	isType := func(expr dst.Expr) bool {
+		if se, ok := expr.(*dst.StarExpr); ok {
+			expr = se.X
+		}
+		return isIdentNamed(expr, typeName)
+	}
+
+	elided := func(expr dst.Expr) {
+		if ue, ok := expr.(*dst.UnaryExpr); ok && ue.Op == token.AND {
+			expr = ue.X
+		}
+		if kv, ok := expr.(*dst.KeyValueExpr); ok {
+			expr = kv.Value
+		}
+		if cl, ok := expr.(*dst.CompositeLit); ok && cl.Type == nil {
+			fn(cl)
+		}
+	}
+
+	pre := func(c *dstutil.Cursor) bool {
+		cl, ok := c.Node().(*dst.CompositeLit)
+		if !ok {
+			return true
+		}
+
+		switch t := cl.Type.(type) {
+		case *dst.Ident:
+			if isType(t) {
+				fn(cl)
+			}
+		case *dst.ArrayType:
+			if isType(t.Elt) {
+				for _, elt := range cl.Elts {
+					elided(elt)
+				}
+			}
+		case *dst.MapType:
+			if isType(t.Value) {
+				for _, elt := range cl.Elts {
+					elided(elt)
+				}
+			}
+		}
+		return true
+	}
+
+	dstutil.Apply(df, pre, nil)
+}
@@ -0,0 +1,189 @@
+package gorefactor
+
+import (
+	"github.com/dave/dst"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHasFieldInStruct(t *testing.T) {
+	var src = `
+	package main
+
+	import "sync"
+
+	type A struct {
+		sync.Mutex
+		*B
+		a, b int
+		c    string
+	}
+
+	type B struct{}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+
+	cases := []struct {
+		typeName  string
+		fieldName string
+		expected  bool
+	}{
+		{"A", "Mutex", true},
+		{"A", "B", true},
+		{"A", "a", true},
+		{"A", "b", true},
+		{"A", "c", true},
+		{"A", "d", false},
+		{"B", "a", false},
+		{"C", "a", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, HasFieldInStruct(df, c.typeName, c.fieldName))
+	}
+}
+
+func TestAddFieldToStruct(t *testing.T) {
+	var src = `
+	package main
+
+	type A struct {
+		a int
+	}
+	`
+
+	var expected = `
+	package main
+
+	import "sync"
+
+	type A struct {
+		sync.Mutex
+		a int
+		b string
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, AddFieldToStruct(df, "A", &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("b")},
+		Type:  dst.NewIdent("string"),
+	}, -1))
+	assert.True(t, AddFieldToStruct(df, "A", &dst.Field{
+		Type: &dst.Ident{Name: "Mutex", Path: "sync"},
+	}, 0))
+	assert.False(t, AddFieldToStruct(df, "B", &dst.Field{Type: dst.NewIdent("int")}, 0))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestDeleteFieldFromStruct(t *testing.T) {
+	var src = `
+	package main
+
+	type A struct {
+		a, b int
+		c    string
+	}
+
+	func main() {
+		_ = A{a: 1, b: 2, c: "c"}
+		_ = &A{b: 2}
+		_ = []A{{b: 1}, {c: "c"}}
+		_ = map[string]*A{"x": {a: 1, b: 2}}
+		_ = A{1, 2, "c"}
+		_ = []A{{3, 4, "d"}}
+		_ = B{b: 1}
+	}
+	`
+
+	var expected = `
+	package main
+
+	type A struct {
+		a int
+		c string
+	}
+
+	func main() {
+		_ = A{a: 1, c: "c"}
+		_ = &A{}
+		_ = []A{{}, {c: "c"}}
+		_ = map[string]*A{"x": {a: 1}}
+		_ = A{1, "c"}
+		_ = []A{{3, "d"}}
+		_ = B{b: 1}
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, DeleteFieldFromStruct(df, "A", "b"))
+	assert.False(t, DeleteFieldFromStruct(df, "A", "d"))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestRenameFieldInStruct(t *testing.T) {
+	var src = `
+	package main
+
+	type A struct {
+		a, b int
+	}
+
+	func main() {
+		_ = A{a: 1, b: 2}
+		_ = []*A{{b: 1}}
+		_ = B{b: 1}
+	}
+	`
+
+	var expected = `
+	package main
+
+	type A struct {
+		a, count int
+	}
+
+	func main() {
+		_ = A{a: 1, count: 2}
+		_ = []*A{{count: 1}}
+		_ = B{b: 1}
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, RenameFieldInStruct(df, "A", "b", "count"))
+	assert.False(t, RenameFieldInStruct(df, "A", "b", "count"))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
+
+func TestSetTagOnStructField(t *testing.T) {
+	var src = `
+	package main
+
+	type A struct {
+		Name string ` + "`json:\"name\"`" + `
+		Age  int
+	}
+	`
+
+	var expected = `
+	package main
+
+	type A struct {
+		Name string ` + "`json:\"name,omitempty\" yaml:\"name\"`" + `
+		Age  int    ` + "`yaml:\"age\"`" + `
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	assert.True(t, SetTagOnStructField(df, "A", "Name", "yaml", "name"))
+	assert.True(t, SetTagOptionOnStructField(df, "A", "Name", "json", "omitempty", true))
+	assert.False(t, SetTagOptionOnStructField(df, "A", "Name", "json", "omitempty", true))
+	assert.True(t, SetTagOnStructField(df, "A", "Age", "json", "age,omitempty"))
+	assert.True(t, SetTagOptionOnStructField(df, "A", "Age", "json", "omitempty", false))
+	assert.True(t, SetTagOnStructField(df, "A", "Age", "yaml", "age"))
+	assert.True(t, DeleteTagFromStructField(df, "A", "Age", "json"))
+	assert.False(t, DeleteTagFromStructField(df, "A", "Age", "json"))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+}
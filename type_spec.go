@@ -0,0 +1,55 @@
+package gorefactor
+
+import (
+	"github.com/dave/dst"
+	"go/token"
+)
+
+// HasTypeParamInTypeSpec checks if the type params of the generic type, contains the given field
+func HasTypeParamInTypeSpec(df *dst.File, typeName string, field *dst.Field) (ret bool) {
+	if ts := findTypeSpec(df, typeName); ts != nil {
+		ret = hasFieldInFieldList(ts.TypeParams, field)
+	}
+	return
+}
+
+// DeleteTypeParamFromTypeSpec deletes any field, in the type params of the generic type,
+// that is semantically equal to given field
+func DeleteTypeParamFromTypeSpec(df *dst.File, typeName string, field *dst.Field) (modified bool) {
+	if ts := findTypeSpec(df, typeName); ts != nil {
+		modified = deleteFieldFromFieldList(&ts.TypeParams, field)
+	}
+	return
+}
+
+// AddTypeParamToTypeSpec adds given field, to the type params of the type, in the given position
+func AddTypeParamToTypeSpec(df *dst.File, typeName string, field *dst.Field, pos int) (modified bool) {
+	if ts := findTypeSpec(df, typeName); ts != nil {
+		addFieldToFieldList(&ts.TypeParams, field, pos)
+		modified = true
+	}
+	return
+}
+
+// SetTypeParamConstraintOnTypeSpec sets the constraint of the type param of given name, of the generic type
+func SetTypeParamConstraintOnTypeSpec(df *dst.File, typeName, paramName string, constraint dst.Expr) (modified bool) {
+	if ts := findTypeSpec(df, typeName); ts != nil {
+		modified = setConstraintInFieldList(ts.TypeParams, paramName, constraint)
+	}
+	return
+}
+
+func findTypeSpec(df *dst.File, typeName string) *dst.TypeSpec {
+	for _, decl := range df.Decls {
+		gd, ok := decl.(*dst.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			if ts := spec.(*dst.TypeSpec); ts.Name.Name == typeName {
+				return ts
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package gorefactor
+
+import (
+	"github.com/dave/dst"
+	"github.com/stretchr/testify/assert"
+	"go/token"
+	"testing"
+)
+
+func TestTypeParamsOfTypeSpec(t *testing.T) {
+	var src = `
+	package main
+
+	type Pair[K, V any] struct {
+		Key   K
+		Value V
+	}
+	`
+
+	var expected = `
+	package main
+
+	type Pair[K comparable, V any, W ~int | ~string] struct {
+		Key   K
+		Value V
+	}
+	`
+
+	df, _ := ParseSrcFileFromBytes([]byte(src))
+	wParam := &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("W")},
+		Type: &dst.BinaryExpr{
+			X:  &dst.UnaryExpr{Op: token.TILDE, X: dst.NewIdent("int")},
+			Op: token.OR,
+			Y:  &dst.UnaryExpr{Op: token.TILDE, X: dst.NewIdent("string")},
+		},
+	}
+
+	assert.True(t, SetTypeParamConstraintOnTypeSpec(df, "Pair", "K", dst.NewIdent("comparable")))
+	assert.True(t, AddTypeParamToTypeSpec(df, "Pair", wParam, -1))
+	assert.True(t, HasTypeParamInTypeSpec(df, "Pair", wParam))
+	assert.False(t, AddTypeParamToTypeSpec(df, "Missing", wParam, -1))
+	assertCodesEqual(t, expected, printToBuf(df).String())
+
+	assert.True(t, DeleteTypeParamFromTypeSpec(df, "Pair", wParam))
+	assert.False(t, HasTypeParamInTypeSpec(df, "Pair", wParam))
+}
@@ -2,6 +2,8 @@ package gorefactor
 
 import (
 	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"go/parser"
 )
 
 func exprListsEqual(la, lb []dst.Expr) bool {
@@ -99,6 +101,18 @@ func nodesEqual(a, b dst.Node) (ret bool) {
 		na := a.(*dst.CallExpr)
 		nb, ok := b.(*dst.CallExpr)
 		return ok && nodesEqual(na.Fun, nb.Fun) && exprListsEqual(na.Args, nb.Args)
+	case *dst.ParenExpr:
+		na := a.(*dst.ParenExpr)
+		nb, ok := b.(*dst.ParenExpr)
+		return ok && nodesEqual(na.X, nb.X)
+	case *dst.IndexExpr:
+		na := a.(*dst.IndexExpr)
+		nb, ok := b.(*dst.IndexExpr)
+		return ok && nodesEqual(na.X, nb.X) && nodesEqual(na.Index, nb.Index)
+	case *dst.IndexListExpr:
+		na := a.(*dst.IndexListExpr)
+		nb, ok := b.(*dst.IndexListExpr)
+		return ok && nodesEqual(na.X, nb.X) && exprListsEqual(na.Indices, nb.Indices)
 	case *dst.UnaryExpr:
 		na := a.(*dst.UnaryExpr)
 		nb, ok := b.(*dst.UnaryExpr)
@@ -151,3 +165,96 @@ func normalizePos(pos, total int) int {
 
 	return pos
 }
+
+// parseExpr parses the given src of go expression into dst.Expr
+func parseExpr(src string) (dst.Expr, error) {
+	expr, err := parser.ParseExprFrom(defaultFileSet, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := decorator.NewDecorator(defaultFileSet).DecorateNode(expr)
+	if err != nil {
+		return nil, err
+	}
+	return node.(dst.Expr), nil
+}
+
+func hasFieldInFieldList(fl *dst.FieldList, field *dst.Field) bool {
+	if fl == nil {
+		return false
+	}
+	for _, ff := range fl.List {
+		if nodesEqual(ff, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteFieldFromFieldList deletes fields equal to the given one, the field list is set to nil if
+// it's empty afterwards, as empty type params are not allowed
+func deleteFieldFromFieldList(fl **dst.FieldList, field *dst.Field) (modified bool) {
+	if *fl == nil {
+		return
+	}
+
+	var newList []*dst.Field
+	for _, ff := range (*fl).List {
+		if !nodesEqual(ff, field) {
+			newList = append(newList, ff)
+		} else {
+			modified = true
+		}
+	}
+	(*fl).List = newList
+	if len(newList) == 0 {
+		*fl = nil
+	}
+	return
+}
+
+func addFieldToFieldList(fl **dst.FieldList, field *dst.Field, pos int) {
+	if *fl == nil {
+		*fl = &dst.FieldList{}
+	}
+
+	fieldList := (*fl).List
+	pos = normalizePos(pos, len(fieldList))
+	(*fl).List = append(
+		fieldList[:pos],
+		append([]*dst.Field{dst.Clone(field).(*dst.Field)}, fieldList[pos:]...)...)
+}
+
+// setConstraintInFieldList sets the type of the type param of given name, a param sharing its
+// constraint with others, like K in [K, V any], is split into its own field, in the same position
+func setConstraintInFieldList(fl *dst.FieldList, paramName string, constraint dst.Expr) bool {
+	if fl == nil {
+		return false
+	}
+
+	for i, ff := range fl.List {
+		for j, ident := range ff.Names {
+			if ident.Name != paramName {
+				continue
+			}
+			if len(ff.Names) == 1 {
+				ff.Type = dst.Clone(constraint).(dst.Expr)
+				return true
+			}
+
+			// split into the params before, the param itself and the params after, to keep the order
+			var split []*dst.Field
+			if j > 0 {
+				split = append(split, &dst.Field{Names: ff.Names[:j], Type: ff.Type})
+			}
+			split = append(split, &dst.Field{Names: []*dst.Ident{ident}, Type: dst.Clone(constraint).(dst.Expr)})
+			if j < len(ff.Names)-1 {
+				split = append(split, &dst.Field{Names: ff.Names[j+1:], Type: dst.Clone(ff.Type).(dst.Expr)})
+			}
+			fl.List = append(fl.List[:i:i], append(split, fl.List[i+1:]...)...)
+			return true
+		}
+	}
+	return false
+}